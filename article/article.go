@@ -2,23 +2,26 @@ package article
 
 import (
 	"bufio"
-	"database/sql"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"html"
+	"fmt"
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
-	"code.laria.me/laria.me/dbutils"
+	"code.laria.me/laria.me/htmltransform"
 	"code.laria.me/laria.me/markdown"
 )
 
 var (
 	ErrBrokenHeader            = errors.New("The article header is broken")
 	ErrMissingMandatoryHeaders = errors.New("The article header is missing some mandatory headers")
+	ErrInvalidSlug             = errors.New("invalid slug")
 )
 
 type Article struct {
@@ -29,219 +32,163 @@ type Article struct {
 	SummaryHtml string
 	FullHtml    string
 	Tags        map[string]struct{}
+	// FullPlain is the full text without any HTML, for searching
+	FullPlain string
+	// ListHtml is shown in article lists and feeds: The summary (or the full text, if there is none)
+	// with all headings one level lower. It is set at update time.
+	ListHtml string
+	// Updated is the modification time given in the header. If it is zero, it will be derived
+	// from ModTime when the content changed.
+	Updated time.Time
+	// Extra holds all header fields without a special meaning
+	Extra map[string]interface{}
+	// ContentHash is a hash of the whole article source (including the header)
+	ContentHash string
+	// ModTime is the modification time of the article's source file, if known
+	ModTime time.Time
+	// Warnings are problems found while parsing that did not prevent parsing the article
+	Warnings []*ParseError
+	// Series is the name of the series the article is part of, if any
+	Series string
+	// SeriesOrder is the position in the series. Articles with the same position are ordered by publishing date.
+	SeriesOrder int
+	// Toc is the table of contents, built from the headings
+	Toc []TocEntry
+	// WordCount is the number of words in the article, including code
+	WordCount int
+	// ReadingTime is the estimated time needed to read the article
+	ReadingTime time.Duration
+	// Related are the slugs of related articles, most related first
+	Related []string
+	// Aliases are former slugs of the article, requests for them get redirected
+	Aliases []string
+	// BundleDir is the absolute path of the directory of an article loaded with LoadBundle.
+	// It contains the assets of the article.
+	BundleDir string
+	// Links are the slugs of the other articles this article links to. They are set at update time.
+	Links []string
+	// Filename is the file the article was loaded from, if any
+	Filename string
 }
 
-var reHtmlTag = regexp.MustCompile(`<([^>'"]+|'[^']*'|"[^"]*")*>`)
-var reHtmlEntity = regexp.MustCompile(`&[^;]*;`)
+const maxSlugLength = 200
 
-func stripTags(s string) string {
-	s = reHtmlTag.ReplaceAllString(s, "")
-	s = reHtmlEntity.ReplaceAllStringFunc(s, html.UnescapeString)
-	return s
-}
-
-func (a Article) updateDbDetails(tx *sql.Tx, id int64) error {
-	_, err := tx.Exec(`
-		UPDATE article SET
-			published = ?,
-			hidden = ?,
-			title = ?,
-			summary_html = ?,
-			full_html = ?,
-			full_plain = ?
-		WHERE article_id = ?
-	`, a.Published.Format("2006-01-02 15:04:05"), a.Hidden, a.Title, a.SummaryHtml, a.FullHtml, stripTags(a.FullHtml), id)
-
-	return err
-}
+// reSlug describes the characters allowed in slugs. Slugs are used in URLs and file names, so they are kept simple.
+var reSlug = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
 
-func (a Article) createInDb(tx *sql.Tx) (int64, error) {
-	res, err := tx.Exec(`
-		INSERT INTO article SET
-			slug = ?,
-			published = ?,
-			hidden = ?,
-			title = ?,
-			summary_html = ?,
-			full_html = ?,
-			full_plain = ?
-	`, a.Slug, a.Published.Format("2006-01-02 15:04:05"), a.Hidden, a.Title, a.SummaryHtml, a.FullHtml, stripTags(a.FullHtml))
-
-	if err != nil {
-		return 0, err
+// ValidateSlug checks that a slug only contains safe characters
+func ValidateSlug(slug string) error {
+	if len(slug) > maxSlugLength || !reSlug.MatchString(slug) {
+		return fmt.Errorf("%w %q: only letters, digits, '_', '.' and '-' are allowed (and at most %d of them)", ErrInvalidSlug, slug, maxSlugLength)
 	}
-
-	return res.LastInsertId()
+	return nil
 }
 
-func removeTags(tx *sql.Tx, id int64) error {
-	_, err := tx.Exec(`DELETE FROM article_tag WHERE article_id = ?`, id)
-	return err
+// IsPublic checks, if the article is visible to the public at the given time (as returned by WallClock)
+func (a Article) IsPublic(now time.Time) bool {
+	return !a.Hidden && !a.Published.After(now)
 }
 
-func setTags(tx *sql.Tx, id int64, tags map[string]struct{}) error {
-	stmt, err := tx.Prepare(`REPLACE INTO article_tag SET article_id = ?, tag = ?`)
+const (
+	proseWordsPerMinute = 230
+	// Code is read a lot slower than prose
+	codeWordsPerMinute = 80
+)
+
+// AnalyzeText sets FullPlain, WordCount and ReadingTime from FullHtml.
+// ParseArticle already does this, it only needs to be called again after FullHtml was changed.
+func (a *Article) AnalyzeText() error {
+	text, code, err := htmltransform.PlainText(a.FullHtml)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-
-	for tag := range tags {
-		if _, err = stmt.Exec(id, tag); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (a Article) saveToDb(tx *sql.Tx) (int64, error) {
-	var id int64
-	switch err := tx.QueryRow(`SELECT article_id FROM article WHERE slug = ?`, a.Slug).Scan(&id); err {
-	case nil:
-		if err = a.updateDbDetails(tx, id); err != nil {
-			return 0, err
-		}
-	case sql.ErrNoRows:
-		id, err = a.createInDb(tx)
-		if err != nil {
-			return 0, err
-		}
-	default:
-		return 0, err
-	}
-
-	if err := removeTags(tx, id); err != nil {
-		return 0, err
-	}
-
-	if err := setTags(tx, id, a.Tags); err != nil {
-		return 0, err
-	}
 
-	return id, nil
-}
+	a.FullPlain = text
 
-func (a Article) SaveToDb(db *sql.DB) (int64, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return 0, err
-	}
+	codeWords := len(strings.Fields(code))
+	a.WordCount = len(strings.Fields(text))
+	proseWords := a.WordCount - codeWords
 
-	id, err := a.saveToDb(tx)
-	err = dbutils.TxCommitIfOk(tx, err)
-	return id, err
+	minutes := float64(proseWords)/proseWordsPerMinute + float64(codeWords)/codeWordsPerMinute
+	a.ReadingTime = time.Duration(minutes * float64(time.Minute)).Round(time.Second)
+	return nil
 }
 
-func DeleteArticlesFromDbExcept(db *sql.DB, slugs []string) error {
-	if len(slugs) == 0 {
-		return nil
-	}
-
-	query := new(strings.Builder)
-	query.WriteString("DELETE FROM article WHERE slug NOT IN (?")
-
-	for i := 1; i < len(slugs); i++ { // intentionally starting at 1, since the first '?' is already there
-		query.WriteString(",?")
-	}
-
-	query.WriteString(")")
-
-	slugsAsInterfaces := make([]interface{}, 0, len(slugs))
-	for _, slug := range slugs {
-		slugsAsInterfaces = append(slugsAsInterfaces, interface{}(slug))
+// notBefore returns t, or min if t is before min.
+func notBefore(t, min time.Time) time.Time {
+	if t.Before(min) {
+		return min
 	}
-
-	_, err := db.Exec(query.String(), slugsAsInterfaces...)
-	return err
+	return t
 }
 
-func splitTags(s string) map[string]struct{} {
-	tags := make(map[string]struct{})
-
-	parts := strings.Split(s, ",")
-	for _, part := range parts {
-		tag := strings.TrimSpace(part)
-		if tag != "" {
-			tags[tag] = struct{}{}
-		}
+// UpdatedTime determines the modification time to store, given the content hash and
+// modification time currently stored (both are zero values, if the article is new).
+func (a Article) UpdatedTime(storedHash string, storedUpdated time.Time) time.Time {
+	switch {
+	case !a.Updated.IsZero():
+		return notBefore(a.Updated, a.Published)
+	case storedHash == a.ContentHash:
+		return notBefore(storedUpdated, a.Published)
+	case storedHash == "" || a.ModTime.IsZero():
+		// Either the article is new or we don't know anything about its previous content
+		return a.Published
+	default:
+		return notBefore(a.ModTime, a.Published)
 	}
-
-	return tags
 }
 
 func parseDate(s string) (time.Time, error) {
 	return time.Parse("2006-01-02 15:04:05", s)
 }
 
-func parseHeader(scanner *bufio.Scanner) (Article, error) {
-	var article Article
-	var err error
-
-	seenTitle := false
-	seenPublished := false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-
-		if line == "" {
-			break
-		}
-
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			return Article{}, ErrBrokenHeader
-		}
-
-		key := strings.ToLower(strings.TrimSpace(parts[0]))
-		value := strings.TrimSpace(parts[1])
-
-		switch key {
-		case "title":
-			article.Title = value
-			seenTitle = true
-		case "tags":
-			article.Tags = splitTags(value)
-		case "date":
-			if article.Published, err = parseDate(value); err != nil {
-				return Article{}, err
-			}
-			seenPublished = true
-		case "hidden":
-			article.Hidden = strings.ToLower(value) == "yes"
-		}
-	}
-
-	if err = scanner.Err(); err != nil {
-		return Article{}, err
-	}
-
-	if !seenTitle || !seenPublished {
-		return Article{}, ErrMissingMandatoryHeaders
-	}
-
-	return article, nil
+// WallClock converts t into the representation used for header dates: The local wall clock time in UTC.
+func WallClock(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
 }
 
 var reMore = regexp.MustCompile(`^\s*~~+(?i:more)~~+\s*$`)
 
-func parseText(scanner *bufio.Scanner, article *Article) error {
+// reMaybeMore matches lines that were probably intended to be a more marker
+var reMaybeMore = regexp.MustCompile(`^\s*~+\s*(?i:more)\s*~+\s*$`)
+
+func parseText(scanner *lineScanner, article *Article, md *markdown.Parser) error {
 	var err error
 
 	builder := new(strings.Builder)
+	moreLine := 0
+
+	// A summary from the header takes precedence over the ~~more~~ marker
+	hasSummary := article.SummaryHtml != ""
 
 	for scanner.Scan() {
 		line := scanner.Text()
 
 		if reMore.MatchString(line) {
-			if article.SummaryHtml, err = markdown.Parse(builder.String()); err != nil {
-				return err
+			if moreLine != 0 {
+				article.Warnings = append(article.Warnings, &ParseError{
+					Line: scanner.line,
+					Err:  fmt.Errorf("%w, the first one is in line %d", ErrMultipleMoreMarkers, moreLine),
+				})
+			}
+			moreLine = scanner.line
+
+			if !hasSummary {
+				// The summary is a part of the full text, its image problems are reported with the full text
+				var imageErrs markdown.ImageErrors
+				if article.SummaryHtml, err = md.Parse(builder.String()); err != nil && !errors.As(err, &imageErrs) {
+					return err
+				}
 			}
 
 			continue
 		}
 
+		if reMaybeMore.MatchString(line) {
+			article.Warnings = append(article.Warnings, &ParseError{Line: scanner.line, Err: ErrMalformedMoreMarker})
+		}
+
 		builder.WriteString(line)
 		builder.WriteRune('\n')
 	}
@@ -250,44 +197,120 @@ func parseText(scanner *bufio.Scanner, article *Article) error {
 		return err
 	}
 
-	if article.FullHtml, err = markdown.Parse(builder.String()); err != nil {
+	var headings []markdown.Heading
+	var imageErrs markdown.ImageErrors
+	if article.FullHtml, headings, err = md.ParseWithHeadings(builder.String()); errors.As(err, &imageErrs) {
+		for _, imageErr := range imageErrs {
+			article.Warnings = append(article.Warnings, &ParseError{Err: imageErr})
+		}
+	} else if err != nil {
 		return err
 	}
+	article.Toc = buildToc(headings)
 
 	return nil
 }
 
-func ParseArticle(r io.Reader) (Article, error) {
+// ParseArticle parses an article, converting its text with md
+func ParseArticle(r io.Reader, md *markdown.Parser) (Article, error) {
 	var article Article
 
-	scanner := bufio.NewScanner(r)
+	hash := sha256.New()
+	scanner := &lineScanner{Scanner: bufio.NewScanner(io.TeeReader(r, hash))}
 	article, err := parseHeader(scanner)
 	if err != nil {
 		return Article{}, err
 	}
 
-	if err = parseText(scanner, &article); err != nil {
+	if err = parseText(scanner, &article, md); err != nil {
+		return Article{}, err
+	}
+
+	article.ContentHash = hex.EncodeToString(hash.Sum(nil))
+	if err = article.AnalyzeText(); err != nil {
 		return Article{}, err
 	}
 
 	return article, nil
 }
 
-func LoadArticle(filename string) (Article, error) {
+// withFilename adds the filename to a ParseError or ParseErrors, or wraps err into a ParseError
+func withFilename(err error, filename string) error {
+	var parseErrs ParseErrors
+	if errors.As(err, &parseErrs) {
+		for _, parseErr := range parseErrs {
+			parseErr.File = filename
+		}
+		return parseErrs
+	}
+
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.File = filename
+		return parseErr
+	}
+
+	return &ParseError{File: filename, Err: err}
+}
+
+// LoadArticle loads an article from a file. Unless the header contains a slug,
+// the file name without extension is used as the slug.
+func LoadArticle(filename string, md *markdown.Parser) (Article, error) {
 	parts := strings.Split(path.Base(filename), ".")
 	slug := strings.Join(parts[:len(parts)-1], ".")
 
+	return loadArticle(filename, slug, "file name", md)
+}
+
+// BundleIndex is the file containing the article of a bundle directory
+const BundleIndex = "index.md"
+
+// LoadBundle loads an article from the BundleIndex of a bundle directory. The other files
+// in the directory belong to the article. Unless the header contains a slug, the directory name is used as the slug.
+func LoadBundle(dir string, md *markdown.Parser) (Article, error) {
+	article, err := loadArticle(filepath.Join(dir, BundleIndex), filepath.Base(dir), "directory name", md.WithImageDir(dir))
+	if err != nil {
+		return Article{}, err
+	}
+
+	// Articles are served from the store later, possibly from another working directory
+	if article.BundleDir, err = filepath.Abs(dir); err != nil {
+		return Article{}, withFilename(err, article.Filename)
+	}
+	return article, nil
+}
+
+// loadArticle loads an article from a file, using defaultSlug (derived from the source described by slugSource)
+// unless the header contains a slug
+func loadArticle(filename, defaultSlug, slugSource string, md *markdown.Parser) (Article, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return Article{}, err
 	}
 	defer f.Close()
 
-	article, err := ParseArticle(f)
+	article, err := ParseArticle(f, md)
+	if err != nil {
+		return Article{}, withFilename(err, filename)
+	}
+
+	for _, warning := range article.Warnings {
+		warning.File = filename
+	}
+
+	info, err := f.Stat()
 	if err != nil {
 		return Article{}, err
 	}
 
-	article.Slug = slug
+	if article.Slug == "" {
+		if err := ValidateSlug(defaultSlug); err != nil {
+			return Article{}, withFilename(fmt.Errorf("%w (derived from the %s, use a slug header to override)", err, slugSource), filename)
+		}
+		article.Slug = defaultSlug
+	}
+
+	article.Filename = filename
+	article.ModTime = WallClock(info.ModTime())
 	return article, nil
 }
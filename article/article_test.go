@@ -0,0 +1,83 @@
+package article
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.laria.me/laria.me/markdown"
+)
+
+func TestValidateSlug(t *testing.T) {
+	tests := []struct {
+		slug string
+		ok   bool
+	}{
+		{"hello-world", true},
+		{"v1.2_notes", true},
+		{"_draft", true},
+		{"2024", true},
+		{"", false},
+		{".hidden", false},
+		{"-dash", false},
+		{"with space", false},
+		{"a/b", false},
+		{"ümlaut", false},
+		{strings.Repeat("a", maxSlugLength), true},
+		{strings.Repeat("a", maxSlugLength+1), false},
+	}
+
+	for _, test := range tests {
+		err := ValidateSlug(test.slug)
+		if test.ok && err != nil {
+			t.Errorf("ValidateSlug(%q) failed: %s", test.slug, err)
+		}
+		if !test.ok && !errors.Is(err, ErrInvalidSlug) {
+			t.Errorf("ValidateSlug(%q): got %v, want %v", test.slug, err, ErrInvalidSlug)
+		}
+	}
+}
+
+func TestLoadArticleSlug(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		header   string
+		wantSlug string
+		wantErr  error
+	}{
+		{"from file name", "my-post.md", "", "my-post", nil},
+		{"only last extension removed", "v1.2.md", "", "v1.2", nil},
+		{"slug header", "my-post.md", "slug: other\n", "other", nil},
+		{"invalid file name", "my post.md", "", "", ErrInvalidSlug},
+		{"invalid file name with slug header", "my post.md", "slug: fine\n", "fine", nil},
+		{"invalid slug header", "my-post.md", "slug: not fine\n", "", ErrInvalidSlug},
+	}
+
+	md, err := markdown.New(markdown.Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), test.filename)
+		writeTestFile(t, filename, "title: Post\ndate: 2024-04-02 10:00:00\n"+test.header+"\nText\n")
+
+		a, err := LoadArticle(filename, md)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), filename) {
+				t.Errorf("%s: error %q doesn't mention the file", test.name, err)
+			}
+			continue
+		}
+
+		if a.Slug != test.wantSlug {
+			t.Errorf("%s: got slug %q, want %q", test.name, a.Slug, test.wantSlug)
+		}
+	}
+}
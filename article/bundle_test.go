@@ -0,0 +1,179 @@
+package article
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"code.laria.me/laria.me/images"
+	"code.laria.me/laria.me/markdown"
+)
+
+func writeTestFile(t *testing.T, filename, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestPng(t *testing.T, filename string, width, height int) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// imageAttributes maps the src of every image in an HTML fragment to its attributes
+func imageAttributes(t *testing.T, s string) map[string]map[string]string {
+	t.Helper()
+
+	imgs := make(map[string]map[string]string)
+	z := html.NewTokenizer(strings.NewReader(s))
+	for z.Next() != html.ErrorToken {
+		tok := z.Token()
+		if tok.Data != "img" {
+			continue
+		}
+
+		attrs := make(map[string]string)
+		for _, attr := range tok.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+		imgs[attrs["src"]] = attrs
+	}
+
+	return imgs
+}
+
+func TestLoadBundle(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		header   string
+		wantSlug string
+		wantErr  error
+	}{
+		{"slug from directory", "my-post", "", "my-post", nil},
+		{"slug header", "my-post", "slug: other\n", "other", nil},
+		{"invalid directory name", "my post", "", "", ErrInvalidSlug},
+		{"invalid directory name with slug header", "my post", "slug: fine\n", "fine", nil},
+	}
+
+	md, err := markdown.New(markdown.Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), test.dir)
+		writeTestFile(t, filepath.Join(dir, BundleIndex), "title: Bundle\ndate: 2024-04-02 10:00:00\n"+test.header+"\nText\n")
+
+		a, err := LoadBundle(dir, md)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if a.Slug != test.wantSlug {
+			t.Errorf("%s: got slug %q, want %q", test.name, a.Slug, test.wantSlug)
+		}
+		if a.BundleDir != dir || !filepath.IsAbs(a.BundleDir) {
+			t.Errorf("%s: got bundle dir %q, want %q", test.name, a.BundleDir, dir)
+		}
+		if want := filepath.Join(dir, BundleIndex); a.Filename != want {
+			t.Errorf("%s: got filename %q, want %q", test.name, a.Filename, want)
+		}
+	}
+}
+
+func TestLoadBundleImages(t *testing.T) {
+	root := t.TempDir()
+	staticPath := filepath.Join(root, "static")
+	dir := filepath.Join(root, "articles", "pictures")
+
+	writeTestPng(t, filepath.Join(staticPath, "shot.png"), 800, 400)
+	writeTestPng(t, filepath.Join(dir, "img", "local.png"), 600, 300)
+	writeTestPng(t, filepath.Join(root, "articles", "outside.png"), 600, 300)
+	writeTestFile(t, filepath.Join(dir, BundleIndex), `title: Pictures
+date: 2024-04-02 10:00:00
+
+![static](/static/shot.png)
+![bundle](img/local.png)
+![outside](../outside.png)
+![remote](https://example.com/remote.png)
+`)
+
+	md, err := markdown.New(markdown.Options{}, images.NewProcessor(staticPath, "/static/", []int{320}, 0, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := LoadBundle(dir, md)
+	if err != nil {
+		t.Fatalf("LoadBundle failed: %s", err)
+	}
+
+	imgs := imageAttributes(t, a.FullHtml)
+
+	tests := []struct {
+		src, width, height, srcsetSuffix string
+	}{
+		{"/static/shot.png", "800", "400", ", /static/shot.png 800w"},
+		{"img/local.png", "600", "300", ", img/local.png 600w"},
+		{"../outside.png", "", "", ""},
+		{"https://example.com/remote.png", "", "", ""},
+	}
+
+	for _, test := range tests {
+		attrs, ok := imgs[test.src]
+		if !ok {
+			t.Errorf("no image %s in %q", test.src, a.FullHtml)
+			continue
+		}
+
+		if attrs["width"] != test.width || attrs["height"] != test.height {
+			t.Errorf("%s: got size %sx%s, want %sx%s", test.src, attrs["width"], attrs["height"], test.width, test.height)
+		}
+
+		srcset := attrs["srcset"]
+		if test.srcsetSuffix == "" {
+			if srcset != "" {
+				t.Errorf("%s: got srcset %q, want none", test.src, srcset)
+			}
+		} else if !strings.HasPrefix(srcset, "/static/resized/") || !strings.HasSuffix(srcset, test.srcsetSuffix) {
+			t.Errorf("%s: got srcset %q", test.src, srcset)
+		}
+	}
+
+	resized, err := filepath.Glob(filepath.Join(staticPath, images.ResizedDir, "*-320.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resized) != 2 {
+		t.Errorf("got resized images %v, want one for each local image", resized)
+	}
+}
@@ -0,0 +1,110 @@
+package article
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+type frontMatterFormat struct {
+	delimiter string
+	unmarshal func(data []byte, v interface{}) error
+	// errorLine extracts the line (relative to the front matter) from an unmarshal error, or returns 0
+	errorLine func(err error) int
+}
+
+var reYamlErrorLine = regexp.MustCompile(`\bline (\d+)\b`)
+
+func yamlErrorLine(err error) int {
+	m := reYamlErrorLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+func tomlErrorLine(err error) int {
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Position.Line
+	}
+	return 0
+}
+
+var frontMatterFormats = []frontMatterFormat{
+	{"---", yaml.Unmarshal, yamlErrorLine},
+	{"+++", toml.Unmarshal, tomlErrorLine},
+}
+
+func detectFrontMatter(firstLine string) (frontMatterFormat, bool) {
+	firstLine = strings.TrimSpace(firstLine)
+	for _, format := range frontMatterFormats {
+		if firstLine == format.delimiter {
+			return format, true
+		}
+	}
+
+	return frontMatterFormat{}, false
+}
+
+var reFrontMatterKey = regexp.MustCompile(`^["']?([^\s"'=:]+)["']?\s*[:=]`)
+
+// frontMatterKeyLines guesses the lines top level keys are defined in. Good enough for error messages.
+func frontMatterKeyLines(lines []string, firstLine int) map[string]int {
+	keyLines := make(map[string]int)
+	for i, line := range lines {
+		if m := reFrontMatterKey.FindStringSubmatch(line); m != nil {
+			if _, ok := keyLines[m[1]]; !ok {
+				keyLines[m[1]] = firstLine + i
+			}
+		}
+	}
+	return keyLines
+}
+
+// parseFrontMatter parses a YAML or TOML front matter block. The opening delimiter must already be consumed.
+func parseFrontMatter(scanner *lineScanner, format frontMatterFormat) (Article, error) {
+	startLine := scanner.line
+	lines := make([]string, 0)
+	closed := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == format.delimiter {
+			closed = true
+			break
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Article{}, err
+	}
+
+	if !closed {
+		return Article{}, &ParseError{
+			Line: startLine,
+			Err:  fmt.Errorf("%w: front matter is not terminated by %s", ErrBrokenHeader, format.delimiter),
+		}
+	}
+
+	fields := make(map[string]interface{})
+	if err := format.unmarshal([]byte(strings.Join(lines, "\n")), &fields); err != nil {
+		line := startLine
+		if relLine := format.errorLine(err); relLine > 0 {
+			line += relLine
+		}
+
+		return Article{}, &ParseError{Line: line, Err: fmt.Errorf("%w: %s", ErrBrokenHeader, err)}
+	}
+
+	return articleFromFields(fields, frontMatterKeyLines(lines, startLine+1), startLine)
+}
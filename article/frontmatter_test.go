@@ -0,0 +1,123 @@
+package article
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"code.laria.me/laria.me/markdown"
+)
+
+func parseTestArticle(t *testing.T, src string) (Article, error) {
+	t.Helper()
+
+	md, err := markdown.New(markdown.Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ParseArticle(strings.NewReader(src), md)
+}
+
+func TestParseHeaderFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"legacy", `title: Hello
+date: 2024-04-02 10:30:00
+updated: 2024-04-03 08:00:00
+tags: go, web
+hidden: yes
+mood: happy
+
+Text
+`},
+		{"yaml", `---
+title: Hello
+date: 2024-04-02 10:30:00
+updated: 2024-04-03T08:00:00+02:00
+tags: [go, web]
+hidden: true
+mood: happy
+---
+Text
+`},
+		{"toml", `+++
+title = "Hello"
+date = "2024-04-02 10:30:00"
+updated = 2024-04-03T08:00:00+02:00
+tags = ["go", "web"]
+hidden = true
+mood = "happy"
++++
+Text
+`},
+	}
+
+	for _, test := range tests {
+		a, err := parseTestArticle(t, test.src)
+		if err != nil {
+			t.Errorf("%s: ParseArticle failed: %s", test.name, err)
+			continue
+		}
+
+		if a.Title != "Hello" {
+			t.Errorf("%s: got title %q", test.name, a.Title)
+		}
+		if want := time.Date(2024, 4, 2, 10, 30, 0, 0, time.UTC); !a.Published.Equal(want) {
+			t.Errorf("%s: got published %s, want %s", test.name, a.Published, want)
+		}
+		// Native timestamps are interpreted by their wall clock
+		if want := time.Date(2024, 4, 3, 8, 0, 0, 0, time.UTC); !a.Updated.Equal(want) {
+			t.Errorf("%s: got updated %s, want %s", test.name, a.Updated, want)
+		}
+		if want := map[string]struct{}{"go": {}, "web": {}}; !reflect.DeepEqual(a.Tags, want) {
+			t.Errorf("%s: got tags %v", test.name, a.Tags)
+		}
+		if !a.Hidden {
+			t.Errorf("%s: not hidden", test.name)
+		}
+		if want := map[string]interface{}{"mood": "happy"}; !reflect.DeepEqual(a.Extra, want) {
+			t.Errorf("%s: got extra %v", test.name, a.Extra)
+		}
+		if want := "<p>Text</p>\n"; a.FullHtml != want {
+			t.Errorf("%s: got text %q, want %q", test.name, a.FullHtml, want)
+		}
+	}
+}
+
+func TestParseFrontMatterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantLine int
+		wantErr  error
+	}{
+		{"unterminated yaml", "---\ntitle: Hello\ndate: 2024-04-02 10:30:00\n\nText\n", 1, ErrBrokenHeader},
+		{"yaml syntax", "---\ntitle: Hello\ndate: 2024-04-02 10:30:00\n  bad: indent\n---\nText\n", 4, ErrBrokenHeader},
+		{"yaml duplicate key", "---\ntitle: Hello\ntitle: Again\n---\nText\n", 3, ErrBrokenHeader},
+		{"toml syntax", "+++\ntitle = \"Hello\"\ndate = \n+++\nText\n", 3, ErrBrokenHeader},
+		{"wrong type", "---\ntitle: Hello\ndate: 2024-04-02 10:30:00\nhidden: [1, 2]\n---\nText\n", 4, ErrBrokenHeader},
+		{"missing date", "+++\ntitle = \"Hello\"\n+++\nText\n", 1, ErrMissingMandatoryHeaders},
+	}
+
+	for _, test := range tests {
+		_, err := parseTestArticle(t, test.src)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: got error %v without a line", test.name, err)
+			continue
+		}
+		if parseErr.Line != test.wantLine {
+			t.Errorf("%s: got line %d, want %d (%s)", test.name, parseErr.Line, test.wantLine, err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package article
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownHeader       = errors.New("unknown header")
+	ErrMalformedMoreMarker = errors.New("malformed ~~more~~ marker")
+	ErrMultipleMoreMarkers = errors.New("more than one ~~more~~ marker")
+)
+
+// ParseError describes a problem at a location in an article source
+type ParseError struct {
+	File string
+	// Line is the 1-based line number, or 0 if the problem is not tied to a line
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, e.Err)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	default:
+		return e.Err.Error()
+	}
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors are several problems found in an article source, ordered by line
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// UnknownHeaderError is reported as a warning for header keys without special meaning, they end up in Article.Extra
+type UnknownHeaderError struct {
+	Key string
+}
+
+func (e *UnknownHeaderError) Error() string {
+	return fmt.Sprintf("%s %q", ErrUnknownHeader, e.Key)
+}
+
+func (e *UnknownHeaderError) Unwrap() error {
+	return ErrUnknownHeader
+}
+
+// lineScanner is a bufio.Scanner that keeps track of the current line number
+type lineScanner struct {
+	*bufio.Scanner
+	line int
+}
+
+func (s *lineScanner) Scan() bool {
+	if !s.Scanner.Scan() {
+		return false
+	}
+
+	s.line++
+	return true
+}
+
+func parseHeader(scanner *lineScanner) (Article, error) {
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return Article{}, err
+		}
+		return Article{}, ErrMissingMandatoryHeaders
+	}
+
+	firstLine := scanner.Text()
+	if format, ok := detectFrontMatter(firstLine); ok {
+		return parseFrontMatter(scanner, format)
+	}
+
+	return parseLegacyHeader(firstLine, scanner)
+}
+
+// parseLegacyHeader parses a header of "key: value" lines, terminated by an empty line.
+func parseLegacyHeader(firstLine string, scanner *lineScanner) (Article, error) {
+	headerLine := scanner.line
+	fields := make(map[string]interface{})
+	lines := make(map[string]int)
+
+	line := firstLine
+	for {
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			break
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return Article{}, &ParseError{Line: scanner.line, Err: ErrBrokenHeader}
+		}
+
+		key := strings.TrimSpace(parts[0])
+		fields[key] = strings.TrimSpace(parts[1])
+		lines[key] = scanner.line
+
+		if !scanner.Scan() {
+			break
+		}
+		line = scanner.Text()
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Article{}, err
+	}
+
+	return articleFromFields(fields, lines, headerLine)
+}
+
+// articleFromFields builds an article from the header fields. lines maps the keys to the lines they were defined in,
+// headerLine is the line the header starts in. All problems with the fields are reported as ParseErrors.
+func articleFromFields(fields map[string]interface{}, lines map[string]int, headerLine int) (Article, error) {
+	var article Article
+	errs := make(ParseErrors, 0)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if lines[keys[i]] != lines[keys[j]] {
+			return lines[keys[i]] < lines[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	seenTitle := false
+	seenPublished := false
+
+	for _, rawKey := range keys {
+		value := fields[rawKey]
+
+		var err error
+		switch strings.ToLower(rawKey) {
+		case "title":
+			article.Title, err = stringField(rawKey, value)
+			seenTitle = true
+		case "tags":
+			article.Tags, err = tagsField(rawKey, value)
+		case "date":
+			article.Published, err = timeField(rawKey, value)
+			seenPublished = true
+		case "updated":
+			article.Updated, err = timeField(rawKey, value)
+		case "hidden":
+			article.Hidden, err = boolField(rawKey, value)
+		case "slug":
+			if article.Slug, err = stringField(rawKey, value); err == nil {
+				err = ValidateSlug(article.Slug)
+			}
+		case "summary":
+			var summary string
+			if summary, err = stringField(rawKey, value); err == nil {
+				article.SummaryHtml = "<p>" + html.EscapeString(strings.TrimSpace(summary)) + "</p>"
+			}
+		case "series":
+			article.Series, err = stringField(rawKey, value)
+		case "series-order":
+			article.SeriesOrder, err = intField(rawKey, value)
+		case "aliases":
+			article.Aliases, err = aliasesField(rawKey, value)
+		default:
+			if article.Extra == nil {
+				article.Extra = make(map[string]interface{})
+			}
+			article.Extra[rawKey] = value
+
+			article.Warnings = append(article.Warnings, &ParseError{
+				Line: lines[rawKey],
+				Err:  &UnknownHeaderError{Key: rawKey},
+			})
+		}
+
+		if err != nil {
+			errs = append(errs, &ParseError{Line: lines[rawKey], Err: err})
+		}
+	}
+
+	missing := make([]string, 0)
+	if !seenTitle {
+		missing = append(missing, "title")
+	}
+	if !seenPublished {
+		missing = append(missing, "date")
+	}
+	if len(missing) > 0 {
+		// The header starts before all fields, so this comes first
+		errs = append(ParseErrors{{
+			Line: headerLine,
+			Err:  fmt.Errorf("%w: %s", ErrMissingMandatoryHeaders, strings.Join(missing, ", ")),
+		}}, errs...)
+	}
+
+	if len(errs) > 0 {
+		return Article{}, errs
+	}
+
+	return article, nil
+}
+
+func fieldTypeError(key string, value interface{}, want string) error {
+	return fmt.Errorf("%w: %s must be %s, got %T", ErrBrokenHeader, key, want, value)
+}
+
+func stringField(key string, value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fieldTypeError(key, value, "a string")
+	}
+	return s, nil
+}
+
+// stringListField accepts a list of strings or a comma separated string. Empty items are skipped.
+func stringListField(key string, value interface{}) ([]string, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			items = append(items, item)
+		}
+	case []interface{}:
+		items = v
+	default:
+		return nil, fieldTypeError(key, value, "a list of strings")
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fieldTypeError(key, item, "a list of strings")
+		}
+
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+
+	return list, nil
+}
+
+func tagsField(key string, value interface{}) (map[string]struct{}, error) {
+	list, err := stringListField(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]struct{})
+	for _, tag := range list {
+		tags[tag] = struct{}{}
+	}
+	return tags, nil
+}
+
+func aliasesField(key string, value interface{}) ([]string, error) {
+	aliases, err := stringListField(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alias := range aliases {
+		if err := ValidateSlug(alias); err != nil {
+			return nil, err
+		}
+	}
+	return aliases, nil
+}
+
+// timeField accepts native YAML/TOML timestamps as well as strings in the legacy header format.
+// Native timestamps are interpreted by their wall clock, like the legacy format does.
+func timeField(key string, value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		t, err := parseDate(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s %q, expected the format YYYY-MM-DD hh:mm:ss", key, v)
+		}
+		return t, nil
+	case time.Time:
+		return WallClock(v), nil
+	default:
+		return time.Time{}, fieldTypeError(key, value, "a date")
+	}
+}
+
+func intField(key string, value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s must be an integer, got %q", ErrBrokenHeader, key, v)
+		}
+		return i, nil
+	default:
+		return 0, fieldTypeError(key, value, "an integer")
+	}
+}
+
+func boolField(key string, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strings.ToLower(v) == "yes", nil
+	default:
+		return false, fieldTypeError(key, value, "a boolean")
+	}
+}
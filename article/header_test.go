@@ -0,0 +1,141 @@
+package article
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// errorLines returns the lines of the ParseErrors in err
+func errorLines(err error) []int {
+	var parseErrs ParseErrors
+	if !errors.As(err, &parseErrs) {
+		return nil
+	}
+
+	lines := make([]int, 0, len(parseErrs))
+	for _, parseErr := range parseErrs {
+		lines = append(lines, parseErr.Line)
+	}
+	return lines
+}
+
+func warningLines(warnings []*ParseError) []int {
+	lines := make([]int, 0, len(warnings))
+	for _, warning := range warnings {
+		lines = append(lines, warning.Line)
+	}
+	return lines
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		wantLines []int
+		wantErrs  []error
+	}{
+		{
+			name:      "missing headers",
+			src:       "tags: go\n\nText\n",
+			wantLines: []int{1},
+			wantErrs:  []error{ErrMissingMandatoryHeaders},
+		},
+		{
+			name:      "all field problems in line order",
+			src:       "title: Hello\nseries-order: first\ndate: yesterday\nupdated: never\n\nText\n",
+			wantLines: []int{2, 3, 4},
+			wantErrs:  []error{ErrBrokenHeader, nil, nil},
+		},
+		{
+			name:      "missing headers come first",
+			src:       "---\ntags: go\nhidden: [1, 2]\n---\nText\n",
+			wantLines: []int{1, 3},
+			wantErrs:  []error{ErrMissingMandatoryHeaders, ErrBrokenHeader},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := parseTestArticle(t, test.src)
+
+		if got := errorLines(err); !reflect.DeepEqual(got, test.wantLines) {
+			t.Errorf("%s: got errors in lines %v, want %v (%v)", test.name, got, test.wantLines, err)
+			continue
+		}
+
+		var parseErrs ParseErrors
+		errors.As(err, &parseErrs)
+		for i, wantErr := range test.wantErrs {
+			if wantErr != nil && !errors.Is(parseErrs[i], wantErr) {
+				t.Errorf("%s: got error %v, want %v", test.name, parseErrs[i], wantErr)
+			}
+		}
+	}
+
+	_, err := parseTestArticle(t, "title: Hello\nthis is not a header\n\nText\n")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrBrokenHeader) || parseErr.Line != 2 {
+		t.Errorf("got %v, want a broken header in line 2", err)
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		wantLines []int
+		wantErrs  []error
+	}{
+		{
+			name:      "no warnings",
+			src:       "title: Hello\ndate: 2024-04-02 10:30:00\n\nSummary\n~~more~~\nText\n",
+			wantLines: []int{},
+		},
+		{
+			name:      "unknown header",
+			src:       "title: Hello\nmood: happy\ndate: 2024-04-02 10:30:00\n\nText\n",
+			wantLines: []int{2},
+			wantErrs:  []error{ErrUnknownHeader},
+		},
+		{
+			name:      "malformed more marker",
+			src:       "title: Hello\ndate: 2024-04-02 10:30:00\n\nSummary\n~ more ~\nText\n",
+			wantLines: []int{5},
+			wantErrs:  []error{ErrMalformedMoreMarker},
+		},
+		{
+			name:      "multiple more markers",
+			src:       "title: Hello\ndate: 2024-04-02 10:30:00\n\nSummary\n~~more~~\nText\n~~MORE~~\nMore text\n",
+			wantLines: []int{7},
+			wantErrs:  []error{ErrMultipleMoreMarkers},
+		},
+	}
+
+	for _, test := range tests {
+		a, err := parseTestArticle(t, test.src)
+		if err != nil {
+			t.Errorf("%s: ParseArticle failed: %s", test.name, err)
+			continue
+		}
+
+		if got := warningLines(a.Warnings); !reflect.DeepEqual(got, test.wantLines) {
+			t.Errorf("%s: got warnings in lines %v, want %v (%v)", test.name, got, test.wantLines, a.Warnings)
+			continue
+		}
+
+		for i, wantErr := range test.wantErrs {
+			if !errors.Is(a.Warnings[i], wantErr) {
+				t.Errorf("%s: got warning %v, want %v", test.name, a.Warnings[i], wantErr)
+			}
+		}
+	}
+}
+
+func TestParseErrorFilename(t *testing.T) {
+	err := withFilename(ParseErrors{{Line: 1, Err: ErrBrokenHeader}, {Line: 3, Err: ErrMissingMandatoryHeaders}}, "a.md")
+
+	want := "a.md:1: " + ErrBrokenHeader.Error() + "\na.md:3: " + ErrMissingMandatoryHeaders.Error()
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
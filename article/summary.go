@@ -0,0 +1,73 @@
+package article
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// textContent returns the text of a node and its children
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	sb := new(strings.Builder)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+func hasContent(nodes []*html.Node) bool {
+	for _, n := range nodes {
+		if n.Type != html.TextNode || strings.TrimSpace(n.Data) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoSummarize creates a summary from the first top level blocks of an article, unless it already has one.
+// The summary ends after the given number of paragraphs or once the given number of words is reached,
+// whichever comes first. A limit of 0 is ignored, if both are 0, no summary will be created.
+// Short articles that fit into these limits don't get a summary.
+func (a *Article) AutoSummarize(paragraphs, words int) error {
+	if a.SummaryHtml != "" || (paragraphs <= 0 && words <= 0) {
+		return nil
+	}
+
+	nodes, err := html.ParseFragment(strings.NewReader(a.FullHtml), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	buf := new(strings.Builder)
+	seenParagraphs := 0
+	seenWords := 0
+
+	for i, n := range nodes {
+		if (paragraphs > 0 && seenParagraphs >= paragraphs) || (words > 0 && seenWords >= words) {
+			if hasContent(nodes[i:]) {
+				a.SummaryHtml = buf.String()
+			}
+			return nil
+		}
+
+		if n.Type == html.ElementNode && n.DataAtom == atom.P {
+			seenParagraphs++
+		}
+		seenWords += len(strings.Fields(textContent(n)))
+
+		if err := html.Render(buf, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
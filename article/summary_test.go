@@ -0,0 +1,62 @@
+package article
+
+import "testing"
+
+func TestAutoSummarize(t *testing.T) {
+	full := "<h2>Intro</h2>\n<p>One two three.</p>\n<p>Four five six.</p>\n<pre><code>seven eight\n</code></pre>\n<p>Nine ten.</p>\n"
+
+	tests := []struct {
+		name              string
+		summary           string
+		paragraphs, words int
+		want              string
+	}{
+		{"disabled", "", 0, 0, ""},
+		{"existing summary", "<p>Mine</p>", 1, 0, "<p>Mine</p>"},
+		{"one paragraph", "", 1, 0, "<h2>Intro</h2>\n<p>One two three.</p>"},
+		{"two paragraphs", "", 2, 0, "<h2>Intro</h2>\n<p>One two three.</p>\n<p>Four five six.</p>"},
+		{"words end after the block", "", 0, 2, "<h2>Intro</h2>\n<p>One two three.</p>"},
+		{"words first", "", 3, 4, "<h2>Intro</h2>\n<p>One two three.</p>"},
+		{"paragraphs first", "", 1, 100, "<h2>Intro</h2>\n<p>One two three.</p>"},
+		{"code counts as words", "", 0, 9, "<h2>Intro</h2>\n<p>One two three.</p>\n<p>Four five six.</p>\n<pre><code>seven eight\n</code></pre>"},
+		{"short article", "", 3, 0, ""},
+		{"short article by words", "", 0, 11, ""},
+	}
+
+	for _, test := range tests {
+		a := Article{FullHtml: full, SummaryHtml: test.summary}
+		if err := a.AutoSummarize(test.paragraphs, test.words); err != nil {
+			t.Errorf("%s: AutoSummarize failed: %s", test.name, err)
+			continue
+		}
+
+		if a.SummaryHtml != test.want {
+			t.Errorf("%s: got summary %q, want %q", test.name, a.SummaryHtml, test.want)
+		}
+	}
+}
+
+func TestSummaryHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"header", "title: Hello\ndate: 2024-04-02 10:30:00\nsummary: Short & <sweet>\n\nText\n", "<p>Short &amp; &lt;sweet&gt;</p>"},
+		{"header wins against more marker", "title: Hello\ndate: 2024-04-02 10:30:00\nsummary: Header\n\nText\n~~more~~\nMore\n", "<p>Header</p>"},
+		{"more marker", "title: Hello\ndate: 2024-04-02 10:30:00\n\nText\n~~more~~\nMore\n", "<p>Text</p>\n"},
+		{"none", "title: Hello\ndate: 2024-04-02 10:30:00\n\nText\n", ""},
+	}
+
+	for _, test := range tests {
+		a, err := parseTestArticle(t, test.src)
+		if err != nil {
+			t.Errorf("%s: ParseArticle failed: %s", test.name, err)
+			continue
+		}
+
+		if a.SummaryHtml != test.want {
+			t.Errorf("%s: got summary %q, want %q", test.name, a.SummaryHtml, test.want)
+		}
+	}
+}
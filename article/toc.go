@@ -0,0 +1,50 @@
+package article
+
+import "code.laria.me/laria.me/markdown"
+
+// TocEntry is an entry in the table of contents of an article
+type TocEntry struct {
+	Level    int
+	Id       string
+	Title    string
+	Children []TocEntry `json:",omitempty"`
+}
+
+// buildToc nests the headings by their level. Skipped levels don't create empty entries,
+// a heading simply becomes a child of the closest previous heading with a lower level.
+func buildToc(headings []markdown.Heading) []TocEntry {
+	toc, _ := buildTocLevel(headings, 0)
+	return toc
+}
+
+// buildTocLevel builds the entries for all headings with a level greater than parentLevel,
+// until a heading of a lower or equal level is found. Returns the number of consumed headings.
+func buildTocLevel(headings []markdown.Heading, parentLevel int) ([]TocEntry, int) {
+	entries := make([]TocEntry, 0)
+
+	i := 0
+	for i < len(headings) && headings[i].Level > parentLevel {
+		h := headings[i]
+		children, n := buildTocLevel(headings[i+1:], h.Level)
+
+		entries = append(entries, TocEntry{
+			Level:    h.Level,
+			Id:       h.Id,
+			Title:    h.Title,
+			Children: children,
+		})
+
+		i += n + 1
+	}
+
+	return entries, i
+}
+
+// CountTocEntries counts all entries of a table of contents, including the nested ones
+func CountTocEntries(toc []TocEntry) int {
+	n := len(toc)
+	for _, entry := range toc {
+		n += CountTocEntries(entry.Children)
+	}
+	return n
+}
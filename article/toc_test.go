@@ -0,0 +1,81 @@
+package article
+
+import (
+	"reflect"
+	"testing"
+
+	"code.laria.me/laria.me/markdown"
+)
+
+func TestBuildToc(t *testing.T) {
+	h := func(level int, id string) markdown.Heading {
+		return markdown.Heading{Level: level, Id: id, Title: id}
+	}
+	e := func(level int, id string, children ...TocEntry) TocEntry {
+		return TocEntry{Level: level, Id: id, Title: id, Children: children}
+	}
+
+	tests := []struct {
+		name     string
+		headings []markdown.Heading
+		want     []TocEntry
+	}{
+		{"empty", []markdown.Heading{}, []TocEntry{}},
+		{"flat", []markdown.Heading{h(2, "a"), h(2, "b")}, []TocEntry{e(2, "a"), e(2, "b")}},
+		{
+			"nested",
+			[]markdown.Heading{h(1, "a"), h(2, "b"), h(3, "c"), h(2, "d"), h(1, "e")},
+			[]TocEntry{e(1, "a", e(2, "b", e(3, "c")), e(2, "d")), e(1, "e")},
+		},
+		{
+			"skipped level",
+			[]markdown.Heading{h(2, "a"), h(4, "b"), h(3, "c")},
+			[]TocEntry{e(2, "a", e(4, "b"), e(3, "c"))},
+		},
+		{
+			"starts deeper",
+			[]markdown.Heading{h(3, "a"), h(2, "b"), h(3, "c")},
+			[]TocEntry{e(3, "a"), e(2, "b", e(3, "c"))},
+		},
+	}
+
+	// Leaves have empty, non-nil children, normalize them for the comparison
+	var normalize func([]TocEntry)
+	normalize = func(entries []TocEntry) {
+		for i := range entries {
+			if len(entries[i].Children) == 0 {
+				entries[i].Children = nil
+			}
+			normalize(entries[i].Children)
+		}
+	}
+
+	for _, test := range tests {
+		toc := buildToc(test.headings)
+		normalize(toc)
+
+		if !reflect.DeepEqual(toc, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, toc, test.want)
+		}
+		if got, want := CountTocEntries(toc), len(test.headings); got != want {
+			t.Errorf("%s: CountTocEntries = %d, want %d", test.name, got, want)
+		}
+	}
+}
+
+func TestParseToc(t *testing.T) {
+	a, err := parseTestArticle(t, "title: Hello\ndate: 2024-04-02 10:30:00\n\n## Setup *now*\n\nText\n\n### Details\n\n## Setup now\n")
+	if err != nil {
+		t.Fatalf("ParseArticle failed: %s", err)
+	}
+
+	want := []TocEntry{
+		{Level: 2, Id: "setup-now", Title: "Setup now", Children: []TocEntry{
+			{Level: 3, Id: "details", Title: "Details", Children: []TocEntry{}},
+		}},
+		{Level: 2, Id: "setup-now-1", Title: "Setup now", Children: []TocEntry{}},
+	}
+	if !reflect.DeepEqual(a.Toc, want) {
+		t.Errorf("got %+v, want %+v", a.Toc, want)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"code.laria.me/laria.me/article"
+	"code.laria.me/laria.me/environment"
+	"code.laria.me/laria.me/store"
+)
+
+type staticBuilder struct {
+	ctx    *serveContext
+	router http.Handler
+	outDir string
+}
+
+// dirIndex returns the file that serves the URL path p on static hosting
+func dirIndex(p string) string {
+	return path.Join(p, "index.html")
+}
+
+func writeFile(filename string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, content, 0644)
+}
+
+var redirectTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta http-equiv="refresh" content="0; url={{.}}">
+    <link rel="canonical" href="{{.}}">
+    <title>Redirect</title>
+</head>
+<body><p>This page has moved to <a href="{{.}}">{{.}}</a>.</p></body>
+</html>
+`))
+
+// render requests a URL from the router and writes the response into outFile (a slash separated path
+// relative to the output directory). Redirects are rendered as HTML pages with a meta refresh.
+func (b staticBuilder) render(requestUrl, outFile string) error {
+	rec := httptest.NewRecorder()
+	b.router.ServeHTTP(rec, httptest.NewRequest("GET", requestUrl, nil))
+
+	filename := filepath.Join(b.outDir, filepath.FromSlash(outFile))
+
+	switch rec.Code {
+	case 200:
+		return writeFile(filename, rec.Body.Bytes())
+	case 301, 302:
+		buf := new(strings.Builder)
+		if err := redirectTemplate.Execute(buf, rec.Header().Get("Location")); err != nil {
+			return err
+		}
+		return writeFile(filename, []byte(buf.String()))
+	default:
+		return fmt.Errorf("rendering %s failed with status %d", requestUrl, rec.Code)
+	}
+}
+
+// renderPaginated renders all pages of a paginated listing. requestPath is the escaped form of action.
+func (b staticBuilder) renderPaginated(requestPath, action string, pages int) error {
+	if pages < 1 {
+		pages = 1
+	}
+
+	for page := 1; page <= pages; page++ {
+		u := requestPath
+		if page > 1 {
+			u = fmt.Sprintf("%s?page=%d", requestPath, page)
+		}
+
+		if err := b.render(u, dirIndex(staticPageUrl(action, page))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b staticBuilder) renderArticles(st store.Store) error {
+	articles, _, err := st.Articles(store.Filter{})
+	if err != nil {
+		return err
+	}
+
+	if err := b.renderPaginated("/blog", "/blog", calcPages(len(articles))); err != nil {
+		return err
+	}
+
+	series := make(map[string]struct{})
+
+	for _, a := range articles {
+		if a.Series != "" {
+			series[a.Series] = struct{}{}
+		}
+
+		y, m, d := a.Published.Date()
+
+		// Listings link to articles with zero padded dates, the feed without padding
+		paths := []string{
+			fmt.Sprintf("/blog/%d/%02d/%02d/%s", y, m, d, a.Slug),
+			fmt.Sprintf("/blog/%d/%d/%d/%s", y, m, d, a.Slug),
+			"/blog/q/" + a.Slug,
+		}
+
+		// Aliases only get redirect pages
+		for _, alias := range a.Aliases {
+			paths = append(paths,
+				fmt.Sprintf("/blog/%d/%02d/%02d/%s", y, m, d, alias),
+				fmt.Sprintf("/blog/%d/%d/%d/%s", y, m, d, alias),
+				"/blog/q/"+alias,
+			)
+		}
+
+		for _, p := range paths {
+			if err := b.render(p, dirIndex(p)); err != nil {
+				return err
+			}
+		}
+
+		if a.BundleDir != "" {
+			if err := b.copyBundle(a); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name := range series {
+		if strings.Contains(name, "/") {
+			log.Printf("Skipping series %q, it can not be represented as a file", name)
+			continue
+		}
+
+		if err := b.render("/blog/series/"+url.PathEscape(name), dirIndex("/blog/series/"+name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b staticBuilder) renderArchive(st store.Store) error {
+	if err := b.render("/blog/archive", dirIndex("/blog/archive")); err != nil {
+		return err
+	}
+
+	years, err := st.ArchiveCounts(0, 0)
+	if err != nil {
+		return err
+	}
+
+	for year := range years {
+		yearPath := fmt.Sprintf("/blog/%d", year)
+		if err := b.render(yearPath, dirIndex(yearPath)); err != nil {
+			return err
+		}
+
+		months, err := st.ArchiveCounts(year, 0)
+		if err != nil {
+			return err
+		}
+
+		for month := range months {
+			monthPath := fmt.Sprintf("%s/%d", yearPath, month)
+			if err := b.render(monthPath, dirIndex(monthPath)); err != nil {
+				return err
+			}
+
+			days, err := st.ArchiveCounts(year, month)
+			if err != nil {
+				return err
+			}
+
+			for day := range days {
+				dayPath := fmt.Sprintf("%s/%d", monthPath, day)
+				if err := b.render(dayPath, dirIndex(dayPath)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b staticBuilder) renderTags(st store.Store) error {
+	if err := b.render("/blog/tags", dirIndex("/blog/tags")); err != nil {
+		return err
+	}
+
+	counts, err := st.TagCounts()
+	if err != nil {
+		return err
+	}
+
+	for tag, count := range counts {
+		if strings.Contains(tag, "/") {
+			log.Printf("Skipping tag %q, it can not be represented as a file", tag)
+			continue
+		}
+
+		// The router expects an escaped path, the file will be found by the unescaped one
+		if err := b.renderPaginated("/blog/tags/"+url.PathEscape(tag), "/blog/tags/"+tag, calcPages(count)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b staticBuilder) renderPages() error {
+	if err := b.render("/", "index.html"); err != nil {
+		return err
+	}
+
+	for name := range b.ctx.pages {
+		if err := b.render("/"+url.PathEscape(name), dirIndex(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// copyBundle copies the files of an article's bundle next to the article's page, the links were rewritten to point there
+func (b staticBuilder) copyBundle(a article.Article) error {
+	conf, err := b.ctx.env.Config()
+	if err != nil {
+		return err
+	}
+	untrusted := conf.IsUntrusted(a.BundleDir)
+
+	dest := filepath.Join(b.outDir, filepath.FromSlash(articleUrl(a)))
+
+	return filepath.Walk(a.BundleDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(a.BundleDir, p)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || !isBundleAsset(filepath.ToSlash(rel), untrusted) {
+			return nil
+		}
+
+		return copyFile(p, filepath.Join(dest, rel))
+	})
+}
+
+func copyDir(src, dest string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dest, rel), 0755)
+		}
+
+		return copyFile(p, filepath.Join(dest, rel))
+	})
+}
+
+type buildStep struct {
+	name string
+	f    func() error
+}
+
+// cmdBuild exports the site as static HTML files.
+// The search is not exported, it can not work without a server.
+func cmdBuild(progname string, env *environment.Env, args []string) {
+	flagSet := flag.NewFlagSet(progname+" build", flag.ExitOnError)
+	outDir := flagSet.String("out", "build", "The directory to write the site to")
+	flagSet.Parse(args)
+
+	conf, err := env.Config()
+	if err != nil {
+		log.Fatalf("Could not load config: %s", err)
+	}
+
+	requireCurrentSchema(progname, env)
+
+	st, err := env.Store()
+	if err != nil {
+		log.Fatalf("Could not open store: %s", err)
+	}
+
+	ctx, err := newServeContext(env, st)
+	if err != nil {
+		log.Fatalf("Could not create serveContext: %s", err)
+	}
+
+	if ctx.views, err = LoadStaticViews(conf.TemplatePath); err != nil {
+		log.Fatalf("Failed loading templates: %s", err)
+	}
+
+	b := staticBuilder{
+		ctx:    ctx,
+		router: ctx.router(""),
+		outDir: *outDir,
+	}
+
+	steps := []buildStep{
+		{"pages", b.renderPages},
+		{"articles", func() error { return b.renderArticles(st) }},
+		{"archive", func() error { return b.renderArchive(st) }},
+		{"tags", func() error { return b.renderTags(st) }},
+		{"feed", func() error { return b.render("/blog/feed.xml", "/blog/feed.xml") }},
+	}
+
+	if conf.StaticPath != "" {
+		steps = append(steps, buildStep{"static files", func() error {
+			return copyDir(conf.StaticPath, filepath.Join(*outDir, "static"))
+		}})
+	}
+
+	if ctx.syntaxCss != nil {
+		steps = append(steps, buildStep{"syntax.css", func() error {
+			return b.render("/static/syntax.css", "static/syntax.css")
+		}})
+	}
+
+	for _, step := range steps {
+		if err := step.f(); err != nil {
+			log.Fatalf("Failed exporting %s: %s", step.name, err)
+		}
+	}
+}
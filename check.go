@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.laria.me/laria.me/article"
+	"code.laria.me/laria.me/config"
+	"code.laria.me/laria.me/environment"
+	"code.laria.me/laria.me/markdown"
+	"code.laria.me/laria.me/menu"
+)
+
+type checker struct {
+	conf         *config.Config
+	markdown     *markdown.Parser
+	extraHeaders map[string]struct{}
+	problems     []*article.ParseError
+	// articles are all successfully loaded articles and pages the names of all pages, for resolving wiki links
+	articles []article.Article
+	pages    []string
+}
+
+func (c *checker) report(file string, line int, err error) {
+	var parseErrs article.ParseErrors
+	if errors.As(err, &parseErrs) {
+		for _, parseErr := range parseErrs {
+			c.report(file, line, parseErr)
+		}
+		return
+	}
+
+	var parseErr *article.ParseError
+	if errors.As(err, &parseErr) {
+		if parseErr.File == "" {
+			parseErr.File = file
+		}
+		c.problems = append(c.problems, parseErr)
+		return
+	}
+
+	c.problems = append(c.problems, &article.ParseError{File: file, Line: line, Err: err})
+}
+
+func (c *checker) acceptedWarning(warning *article.ParseError) bool {
+	var unknownHeader *article.UnknownHeaderError
+	if errors.As(warning, &unknownHeader) {
+		_, ok := c.extraHeaders[strings.ToLower(unknownHeader.Key)]
+		return ok
+	}
+
+	return false
+}
+
+// checkLoaded reports the problems of loading an article. Returns whether the article could be loaded.
+func (c *checker) checkLoaded(filename string, a article.Article, err error) bool {
+	if err != nil {
+		c.report(filename, 0, err)
+		return false
+	}
+
+	for _, warning := range a.Warnings {
+		if !c.acceptedWarning(warning) {
+			c.report(filename, 0, warning)
+		}
+	}
+
+	return true
+}
+
+func (c *checker) checkArticles() {
+	articles := make([]article.Article, 0)
+
+	for _, dir := range c.conf.ArticleDirs {
+		filenames, err := regularFilesInDir(dir)
+		if err != nil {
+			c.report(dir, 0, err)
+			continue
+		}
+
+		bundles, err := bundlesInDir(dir)
+		if err != nil {
+			c.report(dir, 0, err)
+			continue
+		}
+
+		for _, filename := range filenames {
+			a, err := article.LoadArticle(filename, c.markdown)
+			if c.checkLoaded(filename, a, err) {
+				articles = append(articles, a)
+			}
+		}
+
+		for _, bundle := range bundles {
+			a, err := article.LoadBundle(bundle, c.markdown)
+			if c.checkLoaded(filepath.Join(bundle, article.BundleIndex), a, err) {
+				articles = append(articles, a)
+			}
+		}
+	}
+
+	for _, collision := range slugCollisions(articles) {
+		c.report(collision.File, 0, collision)
+	}
+
+	for _, problem := range resolveArticleWikiLinks(articles, c.pages) {
+		c.report(problem.File, 0, problem)
+	}
+
+	c.articles = articles
+}
+
+func (c *checker) pagesPath() string {
+	return path.Join(c.conf.ContentRoot, "pages")
+}
+
+// loadPageNames must be called before checking the articles, which can link to pages
+func (c *checker) loadPageNames() {
+	pages, err := pageNamesInDir(c.pagesPath())
+	if err != nil {
+		c.report(c.pagesPath(), 0, err)
+		return
+	}
+
+	c.pages = pages
+}
+
+func (c *checker) checkPages() {
+	filenames, err := regularFilesInDir(c.pagesPath())
+	if err != nil {
+		// Already reported by loadPageNames
+		return
+	}
+
+	targets := wikiLinkTargets(c.articles, c.pages)
+
+	for _, filename := range filenames {
+		if pageName(filepath.Base(filename)) == "" {
+			continue
+		}
+
+		html, err := loadPage(filename, c.markdown)
+
+		var imageErrs markdown.ImageErrors
+		if errors.As(err, &imageErrs) {
+			for _, imageErr := range imageErrs {
+				c.report(filename, 0, imageErr)
+			}
+		} else if err != nil {
+			c.report(filename, 0, err)
+			continue
+		}
+
+		_, unresolved, err := resolveWikiLinks(string(html), targets, nil)
+		if err != nil {
+			c.report(filename, 0, err)
+			continue
+		}
+
+		for _, target := range unresolved {
+			c.report(filename, 0, fmt.Errorf("%w to %q: no article or page with that name", errBrokenWikiLink, target))
+		}
+	}
+}
+
+// lineOfOffset returns the line number of a byte offset
+func lineOfOffset(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+func (c *checker) checkMenu() {
+	menuPath := path.Join(c.conf.ContentRoot, "menu.json")
+
+	content, err := os.ReadFile(menuPath)
+	if err != nil {
+		c.report(menuPath, 0, err)
+		return
+	}
+
+	if _, err := menu.Parse(bytes.NewReader(content)); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+
+		line := 0
+		switch {
+		case errors.As(err, &syntaxErr):
+			line = lineOfOffset(content, syntaxErr.Offset)
+		case errors.As(err, &typeErr):
+			line = lineOfOffset(content, typeErr.Offset)
+		}
+
+		c.report(menuPath, line, err)
+	}
+}
+
+// cmdCheck validates all articles, pages and the menu, reporting problems with file and line.
+// Exits with a non-zero status if any problem was found.
+func cmdCheck(progname string, env *environment.Env, args []string) {
+	conf, err := env.Config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not load config: %s\n", err)
+		os.Exit(2)
+	}
+
+	// check must not change anything, so images are only validated
+	md, err := env.DryRunMarkdown()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not set up markdown renderer: %s\n", err)
+		os.Exit(2)
+	}
+
+	c := &checker{
+		conf:         conf,
+		markdown:     md,
+		extraHeaders: make(map[string]struct{}),
+	}
+
+	for _, key := range conf.ExtraHeaders {
+		c.extraHeaders[strings.ToLower(key)] = struct{}{}
+	}
+
+	c.loadPageNames()
+	c.checkArticles()
+	c.checkPages()
+	c.checkMenu()
+
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		a, b := c.problems[i], c.problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+
+	for _, problem := range c.problems {
+		fmt.Println(problem)
+	}
+
+	if len(c.problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(c.problems))
+		os.Exit(1)
+	}
+}
@@ -2,19 +2,108 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+
+	"code.laria.me/laria.me/markdown"
+	"code.laria.me/laria.me/sanitize"
 )
 
+// SummaryConfig configures the automatic summaries of articles without a ~~more~~ marker or summary header.
+// A summary ends after Paragraphs paragraphs or once Words words are reached. Limits of 0 are ignored,
+// no summaries are created if both are 0.
+type SummaryConfig struct {
+	Paragraphs int
+	Words      int
+}
+
+// SanitizeConfig configures the sanitization of HTML from untrusted sources
+type SanitizeConfig struct {
+	// UntrustedPaths lists files and directories with untrusted content, like an article dir for guest posts
+	UntrustedPaths []string `json:",omitempty"`
+	// Policy replaces the default allowlist of elements and attributes
+	Policy *sanitize.Policy `json:",omitempty"`
+}
+
+// HighlightCssConfig configures the stylesheet for highlighted code blocks.
+// The style for light color schemes is Markdown.HighlightStyle.
+type HighlightCssConfig struct {
+	// DarkStyle is an optional style for users preferring a dark color scheme
+	DarkStyle string `json:",omitempty"`
+	// Serve serves the generated stylesheet as /static/syntax.css instead of a file from StaticPath
+	Serve bool `json:",omitempty"`
+}
+
+// ImagesConfig configures generating resized versions of the images in StaticPath
+type ImagesConfig struct {
+	// Widths of the resized versions. Images are never enlarged.
+	Widths []int
+	// Quality is the JPEG quality, a default is used if 0
+	Quality int `json:",omitempty"`
+	// Sizes is the sizes attribute of the images, telling browsers how wide the images will be displayed
+	Sizes string `json:",omitempty"`
+}
+
 type Config struct {
 	ContentRoot  string
 	ArticleDirs  []string
+	DbDriver     string `json:",omitempty"` // "mysql" (default) or "sqlite"
 	DbDsn        string
 	TemplatePath string
 	StaticPath   string `json:",omitempty"`
 	HttpLaddr    string
 	Secret       string
 	UpdateUrl    string
+	// ExtraHeaders lists the custom article header keys the check command accepts
+	ExtraHeaders []string `json:",omitempty"`
+	AutoSummary  SummaryConfig
+	// HeadingAnchors adds a link to itself to every heading of an article
+	HeadingAnchors bool `json:",omitempty"`
+	// Markdown enables optional Markdown extensions
+	Markdown     markdown.Options
+	Sanitize     SanitizeConfig
+	HighlightCss HighlightCssConfig
+	// Images enables resizing images, if set. Requires StaticPath.
+	Images *ImagesConfig `json:",omitempty"`
+}
+
+// SanitizePolicy returns the policy for sanitizing untrusted content
+func (c *Config) SanitizePolicy() sanitize.Policy {
+	if c.Sanitize.Policy != nil {
+		return *c.Sanitize.Policy
+	}
+
+	return sanitize.DefaultPolicy
+}
+
+// IsUntrusted checks if a file is in one of the untrusted paths. Paths are compared as absolute paths,
+// a file that can't be located is considered untrusted.
+func (c *Config) IsUntrusted(filename string) bool {
+	if len(c.Sanitize.UntrustedPaths) == 0 {
+		return false
+	}
+
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return true
+	}
+
+	for _, untrusted := range c.Sanitize.UntrustedPaths {
+		untrusted, err := filepath.Abs(untrusted)
+		if err != nil {
+			return true
+		}
+
+		rel, err := filepath.Rel(untrusted, filename)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func loadConfig(configPath string) (*Config, error) {
@@ -31,6 +120,13 @@ func loadConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	// Resolved once, so IsUntrusted compares files with the paths as they were meant when the config was loaded
+	for i, untrusted := range conf.Sanitize.UntrustedPaths {
+		if conf.Sanitize.UntrustedPaths[i], err = filepath.Abs(untrusted); err != nil {
+			return nil, fmt.Errorf("untrusted path %q: %w", untrusted, err)
+		}
+	}
+
 	return &conf, nil
 }
 
@@ -2,19 +2,19 @@
 package environment
 
 import (
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
-
 	"code.laria.me/laria.me/config"
+	"code.laria.me/laria.me/images"
+	"code.laria.me/laria.me/markdown"
+	"code.laria.me/laria.me/store"
 )
 
 // Env provides commonly used data in the application
 type Env struct {
 	configPath string
 
-	config *config.Config
-	db     *sql.DB
+	config   *config.Config
+	store    store.Store
+	markdown *markdown.Parser
 }
 
 func New(configPath string) *Env {
@@ -37,9 +37,9 @@ func (e *Env) Config() (*config.Config, error) {
 	return conf, nil
 }
 
-func (e *Env) DB() (*sql.DB, error) {
-	if e.db != nil {
-		return e.db, nil
+func (e *Env) Store() (store.Store, error) {
+	if e.store != nil {
+		return e.store, nil
 	}
 
 	conf, err := e.Config()
@@ -47,12 +47,50 @@ func (e *Env) DB() (*sql.DB, error) {
 		return nil, err
 	}
 
-	var db *sql.DB
-	db, err = sql.Open("mysql", conf.DbDsn)
+	s, err := store.Open(conf.DbDriver, conf.DbDsn)
 	if err != nil {
 		return nil, err
 	}
 
-	e.db = db
-	return db, nil
+	e.store = s
+	return s, nil
+}
+
+// Markdown returns the Markdown parser with the extensions enabled in the config
+func (e *Env) Markdown() (*markdown.Parser, error) {
+	if e.markdown != nil {
+		return e.markdown, nil
+	}
+
+	md, err := e.newMarkdown(false)
+	if err != nil {
+		return nil, err
+	}
+
+	e.markdown = md
+	return md, nil
+}
+
+// DryRunMarkdown returns a Markdown parser like Markdown, but its image processor only validates the images
+// and never writes resized versions to the static path
+func (e *Env) DryRunMarkdown() (*markdown.Parser, error) {
+	return e.newMarkdown(true)
+}
+
+func (e *Env) newMarkdown(dryRun bool) (*markdown.Parser, error) {
+	conf, err := e.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var imageProcessor markdown.ImageProcessor
+	if conf.Images != nil && conf.StaticPath != "" {
+		p := images.NewProcessor(conf.StaticPath, "/static/", conf.Images.Widths, conf.Images.Quality, conf.Images.Sizes)
+		if dryRun {
+			p = p.DryRun()
+		}
+		imageProcessor = p
+	}
+
+	return markdown.New(conf.Markdown, imageProcessor)
 }
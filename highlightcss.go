@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+
+	"code.laria.me/laria.me/environment"
+	"code.laria.me/laria.me/markdown"
+)
+
+// cmdHighlightCss writes the stylesheet for highlighted code blocks, matching the configured styles
+func cmdHighlightCss(progname string, env *environment.Env, args []string) {
+	conf, err := env.Config()
+	if err != nil {
+		log.Fatalf("Could not load config: %s", err)
+	}
+
+	flagSet := flag.NewFlagSet(progname+" highlight-css", flag.ExitOnError)
+	out := flagSet.String("out", "", "The file to write to, instead of stdout")
+	style := flagSet.String("style", conf.Markdown.HighlightStyle, "The style to use, instead of the configured one")
+	darkStyle := flagSet.String("dark-style", conf.HighlightCss.DarkStyle, "The style for a dark color scheme, instead of the configured one")
+	flagSet.Parse(args)
+
+	f := os.Stdout
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			log.Fatalf("Could not create %s: %s", *out, err)
+		}
+	}
+
+	w := bufio.NewWriter(f)
+	if err := markdown.WriteHighlightCss(w, *style, *darkStyle); err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := f.Close(); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,336 @@
+// Package htmltransform rewrites HTML fragments token by token.
+package htmltransform
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// A Transform gets every token of a fragment and returns the tokens to output instead
+type Transform func(t html.Token) []html.Token
+
+// Pipeline is a list of transforms. Every token passes through all transforms in order.
+type Pipeline []Transform
+
+// The text of these elements is not escaped by the tokenizer, so it must not be escaped when rendering it again
+var rawTextElements = map[atom.Atom]struct{}{
+	atom.Iframe:    {},
+	atom.Noembed:   {},
+	atom.Noframes:  {},
+	atom.Noscript:  {},
+	atom.Plaintext: {},
+	atom.Script:    {},
+	atom.Style:     {},
+	atom.Xmp:       {},
+}
+
+func (p Pipeline) transform(t html.Token) []html.Token {
+	tokens := []html.Token{t}
+	for _, f := range p {
+		out := make([]html.Token, 0, len(tokens))
+		for _, t := range tokens {
+			out = append(out, f(t)...)
+		}
+		tokens = out
+	}
+	return tokens
+}
+
+// Apply runs the pipeline over an HTML fragment
+func (p Pipeline) Apply(s string) (string, error) {
+	if len(p) == 0 {
+		return s, nil
+	}
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	buf := new(strings.Builder)
+	inRawText := false
+
+	for {
+		if z.Next() == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return "", err
+			}
+			return buf.String(), nil
+		}
+
+		for _, t := range p.transform(z.Token()) {
+			if t.Type == html.TextToken && inRawText {
+				buf.WriteString(t.Data)
+			} else {
+				buf.WriteString(t.String())
+			}
+
+			_, inRawText = rawTextElements[t.DataAtom]
+			inRawText = inRawText && t.Type == html.StartTagToken
+		}
+	}
+}
+
+func headingLevel(a atom.Atom) int {
+	switch a {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+var headingAtoms = []atom.Atom{atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6}
+
+// shiftHeadingLevel shifts a heading level, keeping it in the valid range
+func shiftHeadingLevel(level, by int) int {
+	level += by
+	if level < 1 {
+		level = 1
+	}
+	if level > 6 {
+		level = 6
+	}
+
+	return level
+}
+
+// ShiftHeadings shifts the levels of all headings, e.g. shifting by 1 turns a h1 into a h2
+func ShiftHeadings(by int) Transform {
+	return func(t html.Token) []html.Token {
+		if t.Type != html.StartTagToken && t.Type != html.EndTagToken {
+			return []html.Token{t}
+		}
+
+		if level := headingLevel(t.DataAtom); level != 0 && by != 0 {
+			t.DataAtom = headingAtoms[shiftHeadingLevel(level, by)-1]
+			t.Data = t.DataAtom.String()
+		}
+
+		return []html.Token{t}
+	}
+}
+
+func getAttr(t html.Token, key string) (string, bool) {
+	for _, attr := range t.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// HeadingAnchors adds a link to itself to every heading with an id
+func HeadingAnchors() Transform {
+	return func(t html.Token) []html.Token {
+		if t.Type != html.StartTagToken || headingLevel(t.DataAtom) == 0 {
+			return []html.Token{t}
+		}
+
+		id, ok := getAttr(t, "id")
+		if !ok || id == "" {
+			return []html.Token{t}
+		}
+
+		return []html.Token{
+			t,
+			{
+				Type:     html.StartTagToken,
+				DataAtom: atom.A,
+				Data:     "a",
+				Attr: []html.Attribute{
+					{Key: "class", Val: "heading-anchor"},
+					{Key: "href", Val: "#" + id},
+					{Key: "aria-hidden", Val: "true"},
+				},
+			},
+			{Type: html.TextToken, Data: "#"},
+			{Type: html.EndTagToken, DataAtom: atom.A, Data: "a"},
+		}
+	}
+}
+
+// rewriteAttr replaces the value of an attribute with the result of rewrite
+func rewriteAttr(t html.Token, key string, rewrite func(string) string) html.Token {
+	attrs := make([]html.Attribute, len(t.Attr))
+	copy(attrs, t.Attr)
+	for i, attr := range attrs {
+		if attr.Namespace == "" && attr.Key == key {
+			attrs[i].Val = rewrite(attr.Val)
+		}
+	}
+	t.Attr = attrs
+
+	return t
+}
+
+// RewriteLinks replaces the href of every link with the result of rewrite
+func RewriteLinks(rewrite func(href string) string) Transform {
+	return func(t html.Token) []html.Token {
+		if t.Type != html.StartTagToken || t.DataAtom != atom.A {
+			return []html.Token{t}
+		}
+
+		return []html.Token{rewriteAttr(t, "href", rewrite)}
+	}
+}
+
+// rewriteSrcset applies rewrite to every URL of a srcset attribute, keeping the descriptors
+func rewriteSrcset(srcset string, rewrite func(string) string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			fields[0] = rewrite(fields[0])
+		}
+		candidates[i] = strings.Join(fields, " ")
+	}
+
+	return strings.Join(candidates, ", ")
+}
+
+// RewriteImageSources replaces the src of every image and the URLs in its srcset with the result of rewrite
+func RewriteImageSources(rewrite func(src string) string) Transform {
+	return func(t html.Token) []html.Token {
+		if (t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken) || t.DataAtom != atom.Img {
+			return []html.Token{t}
+		}
+
+		t = rewriteAttr(t, "src", rewrite)
+		t = rewriteAttr(t, "srcset", func(srcset string) string {
+			return rewriteSrcset(srcset, rewrite)
+		})
+		return []html.Token{t}
+	}
+}
+
+// Links returns the href of every link in an HTML fragment
+func Links(s string) ([]string, error) {
+	z := html.NewTokenizer(strings.NewReader(s))
+	links := make([]string, 0)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return links, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.DataAtom != atom.A {
+				continue
+			}
+
+			if href, ok := getAttr(t, "href"); ok {
+				links = append(links, href)
+			}
+		}
+	}
+}
+
+// ImageAttributes sets attributes of all images that don't already have them
+func ImageAttributes(defaults []html.Attribute) Transform {
+	return func(t html.Token) []html.Token {
+		if (t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken) || t.DataAtom != atom.Img {
+			return []html.Token{t}
+		}
+
+		attrs := make([]html.Attribute, len(t.Attr), len(t.Attr)+len(defaults))
+		copy(attrs, t.Attr)
+		for _, attr := range defaults {
+			if _, ok := getAttr(t, attr.Key); !ok {
+				attrs = append(attrs, attr)
+			}
+		}
+		t.Attr = attrs
+
+		return []html.Token{t}
+	}
+}
+
+// Elements that don't separate words
+var inlineElements = map[atom.Atom]struct{}{
+	atom.A:      {},
+	atom.Abbr:   {},
+	atom.B:      {},
+	atom.Code:   {},
+	atom.Del:    {},
+	atom.Em:     {},
+	atom.I:      {},
+	atom.Ins:    {},
+	atom.Kbd:    {},
+	atom.Mark:   {},
+	atom.Q:      {},
+	atom.S:      {},
+	atom.Samp:   {},
+	atom.Small:  {},
+	atom.Span:   {},
+	atom.Strong: {},
+	atom.Sub:    {},
+	atom.Sup:    {},
+	atom.U:      {},
+	atom.Var:    {},
+}
+
+// PlainText returns the text of an HTML fragment. Also returns the text inside of pre elements separately.
+// Block elements separate words, the content of scripts and styles is skipped.
+func PlainText(s string) (text, code string, err error) {
+	z := html.NewTokenizer(strings.NewReader(s))
+	textBuf := new(strings.Builder)
+	codeBuf := new(strings.Builder)
+	preDepth := 0
+	skip := false
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return "", "", err
+			}
+			return textBuf.String(), codeBuf.String(), nil
+		case html.TextToken:
+			if skip {
+				continue
+			}
+
+			t := z.Token()
+			textBuf.WriteString(t.Data)
+			if preDepth > 0 {
+				codeBuf.WriteString(t.Data)
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+
+			_, raw := rawTextElements[t.DataAtom]
+			skip = raw && tt == html.StartTagToken
+
+			if t.DataAtom == atom.Pre {
+				switch tt {
+				case html.StartTagToken:
+					preDepth++
+				case html.EndTagToken:
+					if preDepth > 0 {
+						preDepth--
+					}
+				}
+			}
+
+			if _, ok := inlineElements[t.DataAtom]; !ok {
+				textBuf.WriteByte('\n')
+				if preDepth > 0 {
+					codeBuf.WriteByte('\n')
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package htmltransform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestApplyRoundTrip(t *testing.T) {
+	// A pipeline that leaves every token as it is must not change the HTML
+	identity := Pipeline{func(t html.Token) []html.Token { return []html.Token{t} }}
+
+	for _, s := range []string{
+		``,
+		`<p>Hello <em>world</em>!</p>`,
+		`<p>1 &lt; 2 &amp;&amp; 3 &gt; 2</p>`,
+		`<p><a href="/a?b=1&amp;c=2" title="&#34;quoted&#34;">link</a></p>`,
+		`<p><img src="a.png" alt="a"/></p>`,
+		`<pre><code>if a &lt; b {
+	return
+}
+</code></pre>`,
+		`<script>if (a < b && c) { alert("</p>"); }</script>`,
+		`<style>p > a { color: red; }</style>`,
+		`<!-- a comment --><p>text</p>`,
+	} {
+		got, err := identity.Apply(s)
+		if err != nil {
+			t.Errorf("Apply(%q) failed: %s", s, err)
+			continue
+		}
+
+		if got != s {
+			t.Errorf("Apply(%q) = %q", s, got)
+		}
+	}
+}
+
+func TestShiftHeadings(t *testing.T) {
+	tests := []struct {
+		by       int
+		in, want string
+	}{
+		{1, `<h1 id="a">A</h1><h2>B</h2>`, `<h2 id="a">A</h2><h3>B</h3>`},
+		{-1, `<h2>A</h2><h3>B</h3>`, `<h1>A</h1><h2>B</h2>`},
+		{-1, `<h1>A</h1>`, `<h1>A</h1>`},
+		{2, `<h5>A</h5><h6>B</h6>`, `<h6>A</h6><h6>B</h6>`},
+		{1, `<p>no <b>headings</b></p>`, `<p>no <b>headings</b></p>`},
+	}
+
+	for _, test := range tests {
+		got, err := Pipeline{ShiftHeadings(test.by)}.Apply(test.in)
+		if err != nil {
+			t.Errorf("ShiftHeadings(%d) on %q failed: %s", test.by, test.in, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("ShiftHeadings(%d) on %q = %q, want %q", test.by, test.in, got, test.want)
+		}
+	}
+}
+
+func TestHeadingAnchors(t *testing.T) {
+	got, err := Pipeline{HeadingAnchors()}.Apply(`<h2 id="intro">Intro</h2><h3>No id</h3>`)
+	if err != nil {
+		t.Fatalf("Apply failed: %s", err)
+	}
+
+	want := `<h2 id="intro"><a class="heading-anchor" href="#intro" aria-hidden="true">#</a>Intro</h2><h3>No id</h3>`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	prefix := func(s string) string {
+		if strings.HasPrefix(s, "/") {
+			return s
+		}
+		return "/base/" + s
+	}
+
+	got, err := Pipeline{RewriteLinks(prefix), RewriteImageSources(prefix)}.Apply(
+		`<a href="page">p</a> <a href="/abs">a</a> <img src="a.png" srcset="a-320.png 320w,  /static/a-640.png 640w, a.png 1000w"/>`,
+	)
+	if err != nil {
+		t.Fatalf("Apply failed: %s", err)
+	}
+
+	want := `<a href="/base/page">p</a> <a href="/abs">a</a> <img src="/base/a.png" srcset="/base/a-320.png 320w, /static/a-640.png 640w, /base/a.png 1000w"/>`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestImageAttributes(t *testing.T) {
+	defaults := []html.Attribute{{Key: "loading", Val: "lazy"}, {Key: "decoding", Val: "async"}}
+
+	got, err := Pipeline{ImageAttributes(defaults)}.Apply(`<img src="a.png"><img src="b.png" loading="eager"/>`)
+	if err != nil {
+		t.Fatalf("Apply failed: %s", err)
+	}
+
+	want := `<img src="a.png" loading="lazy" decoding="async"><img src="b.png" loading="eager" decoding="async"/>`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	links, err := Links(`<p><a href="/a">a</a> <a name="anchor">no href</a> <img src="/img.png"> <a href="https://example.com/b">b</a></p>`)
+	if err != nil {
+		t.Fatalf("Links failed: %s", err)
+	}
+
+	if want := []string{"/a", "https://example.com/b"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %v, want %v", links, want)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	text, code, err := PlainText(`<p>Some <em>emphasized</em> text</p><pre><code>x := 1</code></pre><script>var hidden;</script><p>end</p>`)
+	if err != nil {
+		t.Fatalf("PlainText failed: %s", err)
+	}
+
+	if got, want := strings.Fields(text), []string{"Some", "emphasized", "text", "x", ":=", "1", "end"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got text words %q, want %q", got, want)
+	}
+
+	if got, want := strings.TrimSpace(code), "x := 1"; got != want {
+		t.Errorf("got code %q, want %q", got, want)
+	}
+}
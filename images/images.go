@@ -0,0 +1,206 @@
+// Package images generates resized versions of images for responsive img elements.
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	// GIF and WebP images are not resized, only their dimensions are used
+	_ "golang.org/x/image/webp"
+	_ "image/gif"
+)
+
+// ResizedDir is the directory in the static path the resized images are written to
+const ResizedDir = "resized"
+
+const defaultQuality = 85
+
+// Processor resizes local images, i.e. images in the static directory
+type Processor struct {
+	staticPath string
+	staticUrl  string
+	widths     []int
+	quality    int
+	sizes      string
+	dryRun     bool
+}
+
+// NewProcessor creates a Processor for the images in staticPath, served under staticUrl.
+// widths are the widths of the resized versions, quality is the JPEG quality (a default is used if 0)
+// and sizes is the sizes attribute of the images (omitted if empty).
+func NewProcessor(staticPath, staticUrl string, widths []int, quality int, sizes string) *Processor {
+	if quality <= 0 {
+		quality = defaultQuality
+	}
+
+	return &Processor{
+		staticPath: staticPath,
+		staticUrl:  strings.TrimSuffix(staticUrl, "/") + "/",
+		widths:     widths,
+		quality:    quality,
+		sizes:      sizes,
+	}
+}
+
+// DryRun returns a copy of the Processor that validates images, but never writes resized versions.
+// The srcset attributes it returns may refer to resized images that don't exist.
+func (p *Processor) DryRun() *Processor {
+	dry := *p
+	dry.dryRun = true
+	return &dry
+}
+
+// localFile returns the file an image URL refers to, if it is a local image: An image in the static path or,
+// if dir is not empty, an image in dir referred to by a relative URL
+func (p *Processor) localFile(src, dir string) (string, bool) {
+	if u, err := url.Parse(src); dir != "" && err == nil && u.Scheme == "" && u.Host == "" &&
+		u.Path != "" && !strings.HasPrefix(u.Path, "/") {
+		rel := path.Clean(u.Path)
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return "", false
+		}
+
+		return filepath.Join(dir, filepath.FromSlash(rel)), true
+	}
+
+	if !strings.HasPrefix(src, p.staticUrl) {
+		return "", false
+	}
+
+	rel := path.Clean("/" + strings.TrimPrefix(src, p.staticUrl))[1:]
+	if rel == "" || strings.HasPrefix(rel, ResizedDir+"/") {
+		return "", false
+	}
+
+	return filepath.Join(p.staticPath, filepath.FromSlash(rel)), true
+}
+
+// ProcessImage generates the resized versions of the image with the URL src and returns
+// the attributes of its img element. Returns nil for images that are not local. Relative URLs refer to
+// images in dir, if it is not empty.
+// Resized versions are only generated for JPEG and PNG images and only if they don't exist yet,
+// their file names contain a hash of the original. They are always written to the static path.
+func (p *Processor) ProcessImage(src, dir string) (map[string]string, error) {
+	filename, ok := p.localFile(src, dir)
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	attrs := map[string]string{
+		"width":  strconv.Itoa(conf.Width),
+		"height": strconv.Itoa(conf.Height),
+	}
+
+	if format != "jpeg" && format != "png" {
+		return attrs, nil
+	}
+
+	hash := sha256.Sum256(data)
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	prefix := base + "-" + hex.EncodeToString(hash[:4])
+
+	var img image.Image
+	srcset := make([]string, 0, len(p.widths)+1)
+	for _, width := range p.widths {
+		if width <= 0 || width >= conf.Width {
+			continue
+		}
+
+		name := fmt.Sprintf("%s-%d.%s", prefix, width, format)
+		out := filepath.Join(p.staticPath, ResizedDir, name)
+
+		if _, err := os.Stat(out); os.IsNotExist(err) {
+			if img == nil {
+				if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+					return nil, fmt.Errorf("%s: %w", filename, err)
+				}
+			}
+
+			if !p.dryRun {
+				height := (conf.Height*width + conf.Width/2) / conf.Width
+				if err := p.writeResized(out, img, width, height, format); err != nil {
+					return nil, err
+				}
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		srcset = append(srcset, fmt.Sprintf("%s%s/%s %dw", p.staticUrl, ResizedDir, name, width))
+	}
+
+	if len(srcset) == 0 {
+		return attrs, nil
+	}
+
+	srcset = append(srcset, fmt.Sprintf("%s %dw", src, conf.Width))
+	attrs["srcset"] = strings.Join(srcset, ", ")
+	if p.sizes != "" {
+		attrs["sizes"] = p.sizes
+	}
+
+	return attrs, nil
+}
+
+// writeResized writes a resized version of img. The file is written under a temporary name first,
+// so a file with the final name is always complete.
+func (p *Processor) writeResized(filename string, img image.Image, width, height int, format string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	f, err := os.CreateTemp(filepath.Dir(filename), ".resizing-")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(f, dst, &jpeg.Options{Quality: p.quality})
+	default:
+		err = png.Encode(f, dst)
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// CreateTemp only makes the file readable by the owner
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", filename, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package images
+
+import (
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func writeTestImage(t *testing.T, filename string, width, height int, encode func(f *os.File, img image.Image) error) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := encode(f, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestPng(t *testing.T, filename string, width, height int) {
+	t.Helper()
+	writeTestImage(t, filename, width, height, func(f *os.File, img image.Image) error {
+		return png.Encode(f, img)
+	})
+}
+
+func TestProcessImage(t *testing.T) {
+	root := t.TempDir()
+	staticPath := filepath.Join(root, "static")
+	dir := filepath.Join(root, "bundle")
+
+	writeTestPng(t, filepath.Join(staticPath, "big.png"), 800, 400)
+	writeTestPng(t, filepath.Join(staticPath, "small.png"), 200, 100)
+	writeTestPng(t, filepath.Join(staticPath, ResizedDir, "old.png"), 800, 400)
+	writeTestPng(t, filepath.Join(dir, "img", "local.png"), 700, 700)
+	writeTestImage(t, filepath.Join(staticPath, "photo.jpg"), 1200, 900, func(f *os.File, img image.Image) error {
+		return jpeg.Encode(f, img, nil)
+	})
+	writeTestImage(t, filepath.Join(staticPath, "anim.gif"), 640, 480, func(f *os.File, img image.Image) error {
+		return gif.Encode(f, img, nil)
+	})
+
+	p := NewProcessor(staticPath, "/static", []int{320, 640, 1000}, 0, "(min-width: 800px) 800px, 100vw")
+
+	tests := []struct {
+		src, dir      string
+		width, height string
+		// srcset matches the srcset attribute, if it is not empty
+		srcset string
+	}{
+		{"/static/big.png", "", "800", "400", `^/static/resized/big-[0-9a-f]{8}-320\.png 320w, /static/resized/big-[0-9a-f]{8}-640\.png 640w, /static/big\.png 800w$`},
+		{"/static/photo.jpg", "", "1200", "900", `^/static/resized/photo-[0-9a-f]{8}-320\.jpeg 320w, .*-640\.jpeg 640w, .*-1000\.jpeg 1000w, /static/photo\.jpg 1200w$`},
+		{"/static/small.png", "", "200", "100", ""},
+		{"/static/anim.gif", "", "640", "480", ""},
+		{"img/local.png", dir, "700", "700", `^/static/resized/local-[0-9a-f]{8}-320\.png 320w, .*-640\.png 640w, img/local\.png 700w$`},
+		{"/static/big.png", dir, "800", "400", `^/static/resized/big-`},
+		{"/static/resized/old.png", "", "", "", ""},
+		{"img/local.png", "", "", "", ""},
+		{"../static/big.png", dir, "", "", ""},
+		{"https://example.com/big.png", "", "", "", ""},
+		{"//example.com/big.png", dir, "", "", ""},
+	}
+
+	for _, test := range tests {
+		attrs, err := p.ProcessImage(test.src, test.dir)
+		if err != nil {
+			t.Errorf("ProcessImage(%q, %q) failed: %s", test.src, test.dir, err)
+			continue
+		}
+
+		if test.width == "" {
+			if attrs != nil {
+				t.Errorf("ProcessImage(%q, %q): got %v for an image that is not local", test.src, test.dir, attrs)
+			}
+			continue
+		}
+
+		if attrs["width"] != test.width || attrs["height"] != test.height {
+			t.Errorf("ProcessImage(%q, %q): got size %sx%s, want %sx%s", test.src, test.dir, attrs["width"], attrs["height"], test.width, test.height)
+		}
+
+		if test.srcset == "" {
+			if _, ok := attrs["srcset"]; ok {
+				t.Errorf("ProcessImage(%q, %q): got srcset %q, want none", test.src, test.dir, attrs["srcset"])
+			}
+			if _, ok := attrs["sizes"]; ok {
+				t.Errorf("ProcessImage(%q, %q): got sizes without srcset", test.src, test.dir)
+			}
+			continue
+		}
+
+		if !regexp.MustCompile(test.srcset).MatchString(attrs["srcset"]) {
+			t.Errorf("ProcessImage(%q, %q): got srcset %q, want a match for %s", test.src, test.dir, attrs["srcset"], test.srcset)
+		}
+		if attrs["sizes"] != "(min-width: 800px) 800px, 100vw" {
+			t.Errorf("ProcessImage(%q, %q): got sizes %q", test.src, test.dir, attrs["sizes"])
+		}
+	}
+
+	resized, err := filepath.Glob(filepath.Join(staticPath, ResizedDir, "big-*-320.png"))
+	if err != nil || len(resized) != 1 {
+		t.Fatalf("got resized images %v (%v), want one", resized, err)
+	}
+
+	f, err := os.Open(resized[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	conf, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := [2]int{conf.Width, conf.Height}, [2]int{320, 160}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got resized image of size %v, want %v", got, want)
+	}
+}
+
+func TestProcessImageKeepsResized(t *testing.T) {
+	staticPath := t.TempDir()
+	writeTestPng(t, filepath.Join(staticPath, "a.png"), 800, 400)
+
+	p := NewProcessor(staticPath, "/static/", []int{320}, 0, "")
+	if _, err := p.ProcessImage("/static/a.png", ""); err != nil {
+		t.Fatalf("ProcessImage failed: %s", err)
+	}
+
+	resized, err := filepath.Glob(filepath.Join(staticPath, ResizedDir, "*"))
+	if err != nil || len(resized) != 1 {
+		t.Fatalf("got resized images %v (%v), want one", resized, err)
+	}
+
+	// An existing resized version is not written again
+	if err := os.WriteFile(resized[0], []byte("marker"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ProcessImage("/static/a.png", ""); err != nil {
+		t.Fatalf("ProcessImage failed: %s", err)
+	}
+	if data, err := os.ReadFile(resized[0]); err != nil || string(data) != "marker" {
+		t.Errorf("resized image was written again (%v)", err)
+	}
+
+	// A changed image gets new resized versions
+	writeTestPng(t, filepath.Join(staticPath, "a.png"), 800, 600)
+	if _, err := p.ProcessImage("/static/a.png", ""); err != nil {
+		t.Fatalf("ProcessImage failed: %s", err)
+	}
+	if resized, _ := filepath.Glob(filepath.Join(staticPath, ResizedDir, "*")); len(resized) != 2 {
+		t.Errorf("got resized images %v, want two", resized)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	staticPath := t.TempDir()
+	writeTestPng(t, filepath.Join(staticPath, "a.png"), 800, 400)
+	if err := os.WriteFile(filepath.Join(staticPath, "broken.png"), []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor(staticPath, "/static/", []int{320}, 0, "").DryRun()
+
+	attrs, err := p.ProcessImage("/static/a.png", "")
+	if err != nil {
+		t.Fatalf("ProcessImage failed: %s", err)
+	}
+	if attrs["width"] != "800" || attrs["height"] != "400" || attrs["srcset"] == "" {
+		t.Errorf("got attributes %v", attrs)
+	}
+
+	if _, err := os.Stat(filepath.Join(staticPath, ResizedDir)); !os.IsNotExist(err) {
+		t.Errorf("resized directory was created (%v)", err)
+	}
+
+	for _, src := range []string{"/static/broken.png", "/static/missing.png"} {
+		if _, err := p.ProcessImage(src, ""); err == nil {
+			t.Errorf("ProcessImage(%q) succeeded", src)
+		}
+	}
+}
@@ -12,8 +12,14 @@ type subcmd func(progname string, env *environment.Env, args []string)
 
 func main() {
 	subcmds := map[string]subcmd{
-		"serve":  cmdServe,
-		"update": cmdUpdate,
+		"serve":         cmdServe,
+		"update":        cmdUpdate,
+		"scheduled":     cmdScheduled,
+		"migrate":       cmdMigrate,
+		"build":         cmdBuild,
+		"preview":       cmdPreview,
+		"check":         cmdCheck,
+		"highlight-css": cmdHighlightCss,
 	}
 
 	progname := os.Args[0]
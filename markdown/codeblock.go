@@ -0,0 +1,142 @@
+package markdown
+
+// Fenced code blocks can have attributes after the language, e.g.
+//
+//	```go {hl_lines=[3,5-7] linenos=true title="main.go"}
+//
+// hl_lines highlights lines (counted from 1, even with linenostart), linenos=true enables
+// line numbers and title adds a caption.
+
+import (
+	"html"
+	"strconv"
+	"strings"
+
+	chromaHtml "github.com/alecthomas/chroma/formatters/html"
+	highlighting "github.com/yuin/goldmark-highlighting"
+	"github.com/yuin/goldmark/util"
+)
+
+func codeBlockAttr(c highlighting.CodeBlockContext, name string) (interface{}, bool) {
+	attrs := c.Attributes()
+	if attrs == nil {
+		return nil, false
+	}
+	return attrs.GetString(name)
+}
+
+func codeBlockTitle(c highlighting.CodeBlockContext) string {
+	v, ok := codeBlockAttr(c, "title")
+	if !ok {
+		return ""
+	}
+
+	switch title := v.(type) {
+	case []byte:
+		return string(title)
+	case float64:
+		return strconv.FormatFloat(title, 'f', -1, 64)
+	}
+	return ""
+}
+
+// highlightedLines reads the hl_lines attribute.
+// goldmark-highlighting reads it too, but only understands ranges written as strings ("5-7"),
+// an unquoted 5-7 is parsed as the numbers 5 and -7. We accept both.
+func highlightedLines(c highlighting.CodeBlockContext) [][2]int {
+	v, ok := codeBlockAttr(c, "hl_lines")
+	if !ok {
+		return nil
+	}
+
+	var values []interface{}
+	switch lines := v.(type) {
+	case []interface{}:
+		values = lines
+	default:
+		values = []interface{}{lines}
+	}
+
+	ranges := make([][2]int, 0, len(values))
+	canExtend := false // The last range is a single number, that a negative number can make a range
+	for _, value := range values {
+		switch line := value.(type) {
+		case float64:
+			if line < 0 && canExtend {
+				ranges[len(ranges)-1][1] = int(-line)
+				canExtend = false
+			} else if line > 0 {
+				ranges = append(ranges, [2]int{int(line), int(line)})
+				canExtend = true
+			}
+		case []byte:
+			canExtend = false
+
+			parts := strings.SplitN(string(line), "-", 2)
+			from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+			if err != nil {
+				continue
+			}
+			to := from
+			if len(parts) > 1 {
+				if to, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+					continue
+				}
+			}
+			ranges = append(ranges, [2]int{from, to})
+		}
+	}
+
+	// chroma counts the lines starting with the base line number
+	if v, ok := codeBlockAttr(c, "linenostart"); ok {
+		if start, ok := v.(float64); ok {
+			for i := range ranges {
+				ranges[i][0] += int(start) - 1
+				ranges[i][1] += int(start) - 1
+			}
+		}
+	}
+
+	return ranges
+}
+
+// codeBlockOptions are added to the chroma options of every highlighted code block
+func codeBlockOptions(c highlighting.CodeBlockContext) []chromaHtml.Option {
+	if lines := highlightedLines(c); lines != nil {
+		return []chromaHtml.Option{chromaHtml.HighlightLines(lines)}
+	}
+	return nil
+}
+
+// renderCodeBlockWrapper wraps code blocks with a title in a figure with a caption.
+// Since a wrapper replaces the default one of goldmark-highlighting, it also has to
+// render the pre and code elements of blocks that were not highlighted.
+func renderCodeBlockWrapper(w util.BufWriter, c highlighting.CodeBlockContext, entering bool) {
+	title := codeBlockTitle(c)
+
+	if !entering {
+		if !c.Highlighted() {
+			w.WriteString("</code></pre>\n")
+		}
+		if title != "" {
+			w.WriteString("</figure>\n")
+		}
+		return
+	}
+
+	if title != "" {
+		w.WriteString(`<figure class="code-block"><figcaption>`)
+		w.WriteString(html.EscapeString(title))
+		w.WriteString("</figcaption>\n")
+	}
+
+	if !c.Highlighted() {
+		w.WriteString("<pre><code")
+		if lang, ok := c.Language(); ok {
+			w.WriteString(` class="language-`)
+			w.WriteString(html.EscapeString(string(lang)))
+			w.WriteString(`"`)
+		}
+		w.WriteString(">")
+	}
+}
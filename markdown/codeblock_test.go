@@ -0,0 +1,109 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// highlightedLineNumbers returns the (1-based) positions of the highlighted lines in a rendered code block
+func highlightedLineNumbers(s string) []int {
+	lines := strings.Split(s, `<span class="line`)[1:]
+
+	highlighted := make([]int, 0)
+	for i, line := range lines {
+		if strings.HasPrefix(line, ` hl"`) {
+			highlighted = append(highlighted, i+1)
+		}
+	}
+	return highlighted
+}
+
+func TestCodeBlockHighlightedLines(t *testing.T) {
+	code := "a\nb\nc\nd\ne\nf\n"
+
+	tests := []struct {
+		attrs string
+		want  []int
+	}{
+		{"", []int{}},
+		{"{hl_lines=[2]}", []int{2}},
+		{"{hl_lines=2}", []int{2}},
+		{"{hl_lines=[2,4-5]}", []int{2, 4, 5}},
+		{`{hl_lines=["1-2", 6]}`, []int{1, 2, 6}},
+		{`{hl_lines="3-4"}`, []int{3, 4}},
+		// The lines are counted from 1, even if the line numbers start somewhere else
+		{"{hl_lines=[2-3] linenostart=10}", []int{2, 3}},
+		{`{hl_lines=["x", 0, 5]}`, []int{5}},
+	}
+
+	p, err := New(Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		html, err := p.Parse("```go " + test.attrs + "\n" + code + "```\n")
+		if err != nil {
+			t.Errorf("%s: Parse failed: %s", test.attrs, err)
+			continue
+		}
+
+		if got := highlightedLineNumbers(html); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got highlighted lines %v, want %v", test.attrs, got, test.want)
+		}
+	}
+}
+
+func TestCodeBlockWrapper(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			"plain",
+			"```\n<x>\n```\n",
+			"<pre><code>&lt;x&gt;\n</code></pre>\n",
+		},
+		{
+			"unknown language",
+			"```nosuchlang\nx\n```\n",
+			"<pre><code class=\"language-nosuchlang\">x\n</code></pre>\n",
+		},
+		{
+			"title",
+			"```nosuchlang {title=\"a<b\"}\nx\n```\n",
+			"<figure class=\"code-block\"><figcaption>a&lt;b</figcaption>\n<pre><code class=\"language-nosuchlang\">x\n</code></pre>\n</figure>\n",
+		},
+		{
+			"numeric title",
+			"```nosuchlang {title=2024}\nx\n```\n",
+			"<figure class=\"code-block\"><figcaption>2024</figcaption>\n<pre><code class=\"language-nosuchlang\">x\n</code></pre>\n</figure>\n",
+		},
+	}
+
+	p, err := New(Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		html, err := p.Parse(test.src)
+		if err != nil {
+			t.Errorf("%s: Parse failed: %s", test.name, err)
+			continue
+		}
+
+		if html != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, html, test.want)
+		}
+	}
+
+	html, err := p.Parse("```go {title=\"main.go\" linenos=true linenostart=10}\nx\n```\n")
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if !strings.HasPrefix(html, `<figure class="code-block"><figcaption>main.go</figcaption>`) ||
+		!strings.Contains(html, `<span class="ln">10</span>`) || !strings.HasSuffix(html, "</figure>\n") {
+		t.Errorf("got %q", html)
+	}
+}
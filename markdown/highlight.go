@@ -0,0 +1,76 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/styles"
+)
+
+const DefaultHighlightStyle = "monokai"
+
+var ErrUnknownStyle = errors.New("unknown highlighting style")
+
+func highlightStyle(name string) (*chroma.Style, error) {
+	if name == "" {
+		name = DefaultHighlightStyle
+	}
+
+	style, ok := styles.Registry[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, known styles are: %s", ErrUnknownStyle, name, strings.Join(styles.Names(), ", "))
+	}
+
+	return style, nil
+}
+
+// WriteHighlightCss writes the stylesheet for highlighted code blocks.
+// If darkStyle is not empty, it will be used when the user prefers a dark color scheme.
+func WriteHighlightCss(w io.Writer, style, darkStyle string) error {
+	light, err := highlightStyle(style)
+	if err != nil {
+		return err
+	}
+
+	formatter := html.New(html.WithClasses(true))
+
+	if err := formatter.WriteCSS(w, light); err != nil {
+		return err
+	}
+
+	if darkStyle == "" {
+		return nil
+	}
+
+	dark, err := highlightStyle(darkStyle)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := formatter.WriteCSS(buf, dark); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "@media (prefers-color-scheme: dark) {\n"); err != nil {
+		return err
+	}
+
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+
+		if _, err := io.WriteString(w, "  "+line); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
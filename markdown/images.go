@@ -0,0 +1,97 @@
+package markdown
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ImageProcessor provides additional attributes for images, e.g. for responsive images
+type ImageProcessor interface {
+	// ProcessImage returns the attributes to add to an image with the URL src, or nil to leave it as it is.
+	// Relative URLs refer to files in dir, unless it is empty (see Parser.WithImageDir).
+	ProcessImage(src, dir string) (map[string]string, error)
+}
+
+// imageDirKey stores the directory relative image URLs refer to in the parser context
+var imageDirKey = parser.NewContextKey()
+
+// ImageError is a problem processing an image. The image is left as it is then.
+type ImageError struct {
+	Src string
+	Err error
+}
+
+func (e *ImageError) Error() string {
+	return fmt.Sprintf("image %s: %s", e.Src, e.Err)
+}
+
+func (e *ImageError) Unwrap() error {
+	return e.Err
+}
+
+// ImageErrors are returned by Parser.ParseWithHeadings (and Parse) together with the HTML,
+// if some images could not be processed
+type ImageErrors []*ImageError
+
+func (e ImageErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// imageErrorsKey collects the errors of the image processor in the parser context,
+// since AST transformers can't return errors
+var imageErrorsKey = parser.NewContextKey()
+
+type imageTransformer struct {
+	images ImageProcessor
+}
+
+func (t imageTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := n.(*ast.Image)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		dir, _ := pc.Get(imageDirKey).(string)
+		attrs, err := t.images.ProcessImage(string(img.Destination), dir)
+		if err != nil {
+			errs, _ := pc.Get(imageErrorsKey).(ImageErrors)
+			pc.Set(imageErrorsKey, append(errs, &ImageError{Src: string(img.Destination), Err: err}))
+			return ast.WalkContinue, nil
+		}
+
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			img.SetAttributeString(name, []byte(attrs[name]))
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
+
+func imageParserOption(images ImageProcessor) parser.Option {
+	return parser.WithASTTransformers(util.Prioritized(imageTransformer{images}, 100))
+}
+
+// imageErrors returns the errors of the image processor, if any
+func imageErrors(pc parser.Context) error {
+	if errs, _ := pc.Get(imageErrorsKey).(ImageErrors); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
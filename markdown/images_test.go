@@ -0,0 +1,86 @@
+package markdown
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testImages adds a size to images ending in ".png" and fails for images ending in ".bad"
+type testImages struct{}
+
+var errBadImage = errors.New("bad image")
+
+func (testImages) ProcessImage(src, dir string) (map[string]string, error) {
+	switch {
+	case strings.HasSuffix(src, ".png"):
+		return map[string]string{"width": "10", "height": "5"}, nil
+	case strings.HasSuffix(src, ".bad"):
+		return nil, errBadImage
+	}
+	return nil, nil
+}
+
+func TestImageProcessor(t *testing.T) {
+	p, err := New(Options{}, testImages{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := p.Parse("![a](a.png) ![b](b.jpg) ![c](c.bad) ![d](d.bad)")
+
+	want := `<p><img src="a.png" alt="a" height="5" width="10"> <img src="b.jpg" alt="b"> <img src="c.bad" alt="c"> <img src="d.bad" alt="d"></p>` + "\n"
+	if html != want {
+		t.Errorf("got %q, want %q", html, want)
+	}
+
+	// The HTML is returned together with the errors of all failed images
+	var imageErrs ImageErrors
+	if !errors.As(err, &imageErrs) || len(imageErrs) != 2 {
+		t.Fatalf("got error %v, want two image errors", err)
+	}
+	if imageErrs[0].Src != "c.bad" || imageErrs[1].Src != "d.bad" || !errors.Is(imageErrs[0], errBadImage) {
+		t.Errorf("got image errors %v", imageErrs)
+	}
+
+	// Without a processor, images are left as they are
+	plain, err := New(Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html, err := plain.Parse("![a](a.png)"); err != nil || html != "<p><img src=\"a.png\" alt=\"a\"></p>\n" {
+		t.Errorf("got %q (%v)", html, err)
+	}
+}
+
+// dirImages records the directories images are looked up in
+type dirImages map[string]string
+
+func (d dirImages) ProcessImage(src, dir string) (map[string]string, error) {
+	d[src] = dir
+	return nil, nil
+}
+
+func TestImageDir(t *testing.T) {
+	images := make(dirImages)
+	p, err := New(Options{}, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Parse("![a](a.png)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.WithImageDir("/bundle").Parse("![b](b.png)"); err != nil {
+		t.Fatal(err)
+	}
+	// WithImageDir doesn't change the original parser
+	if _, err := p.Parse("![c](c.png)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (dirImages{"a.png": "", "b.png": "/bundle", "c.png": ""}); !reflect.DeepEqual(images, want) {
+		t.Errorf("got image dirs %v, want %v", images, want)
+	}
+}
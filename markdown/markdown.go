@@ -6,30 +6,175 @@ import (
 	"github.com/alecthomas/chroma/formatters/html"
 	"github.com/yuin/goldmark"
 	highlighting "github.com/yuin/goldmark-highlighting"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
 	goldmarkHtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 )
 
-func Parse(s string) (string, error) {
-	markdown := goldmark.New(
-		goldmark.WithExtensions(
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("monokai"),
-				highlighting.WithFormatOptions(
-					// html.WithAllClasses(true),
-					html.WithClasses(true),
-					html.WithLineNumbers(false),
-				),
+// Heading is a heading of a parsed document
+type Heading struct {
+	Level int
+	Id    string
+	Title string
+}
+
+// Options enables optional Markdown extensions
+type Options struct {
+	// Tables enables GFM tables
+	Tables bool `json:",omitempty"`
+	// Strikethrough enables GFM ~~strikethrough~~
+	Strikethrough bool `json:",omitempty"`
+	// TaskLists enables GFM task list items ("- [x] done")
+	TaskLists bool `json:",omitempty"`
+	// Autolinks turns URLs in the text into links, like GFM does
+	Autolinks bool `json:",omitempty"`
+	// Footnotes enables PHP Markdown Extra style footnotes
+	Footnotes bool `json:",omitempty"`
+	// DefinitionLists enables PHP Markdown Extra style definition lists
+	DefinitionLists bool `json:",omitempty"`
+	// Typographer replaces quotes, dashes and ellipses with their typographic counterparts
+	Typographer bool `json:",omitempty"`
+	// HighlightStyle is the chroma style for code blocks, DefaultHighlightStyle if empty
+	HighlightStyle string `json:",omitempty"`
+}
+
+// Parser converts Markdown to HTML. It can be used concurrently.
+type Parser struct {
+	markdown goldmark.Markdown
+	// imageDir is the directory relative image URLs refer to, if any
+	imageDir string
+}
+
+// WithImageDir returns a Parser whose image processor looks up images with relative URLs in dir,
+// e.g. the images next to an article
+func (p *Parser) WithImageDir(dir string) *Parser {
+	return &Parser{markdown: p.markdown, imageDir: dir}
+}
+
+// New creates a Parser with the extensions enabled in opts. If images is not nil, it processes all images.
+func New(opts Options, images ImageProcessor) (*Parser, error) {
+	style, err := highlightStyle(opts.HighlightStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions := []goldmark.Extender{
+		highlighting.NewHighlighting(
+			highlighting.WithCustomStyle(style),
+			highlighting.WithFormatOptions(
+				// html.WithAllClasses(true),
+				html.WithClasses(true),
+				// Can be enabled per code block with linenos=true
+				html.WithLineNumbers(false),
 			),
+			highlighting.WithCodeBlockOptions(codeBlockOptions),
+			highlighting.WithWrapperRenderer(renderCodeBlockWrapper),
 		),
+		wikiLinks{},
+	}
+
+	for _, ext := range []struct {
+		enabled  bool
+		extender goldmark.Extender
+	}{
+		{opts.Tables, extension.Table},
+		{opts.Strikethrough, extension.Strikethrough},
+		{opts.TaskLists, extension.TaskList},
+		{opts.Autolinks, extension.Linkify},
+		{opts.Footnotes, extension.Footnote},
+		{opts.DefinitionLists, extension.DefinitionList},
+		{opts.Typographer, extension.Typographer},
+	} {
+		if ext.enabled {
+			extensions = append(extensions, ext.extender)
+		}
+	}
+
+	parserOptions := []parser.Option{
+		// Generated IDs are derived from the heading text and deduplicated by appending a number
+		parser.WithAutoHeadingID(),
+	}
+	if images != nil {
+		parserOptions = append(parserOptions, imageParserOption(images))
+	}
+
+	return &Parser{markdown: goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
 		goldmark.WithRendererOptions(
 			goldmarkHtml.WithUnsafe(),
 		),
-	)
+	)}, nil
+}
+
+func (p *Parser) Parse(s string) (string, error) {
+	html, _, err := p.ParseWithHeadings(s)
+	return html, err
+}
+
+// nodeText returns the plain text of an inline node and its children
+func nodeText(n ast.Node, source []byte) string {
+	buf := new(bytes.Buffer)
+
+	ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch v := n.(type) {
+		case *ast.Text:
+			buf.Write(v.Segment.Value(source))
+			if v.SoftLineBreak() || v.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(v.Value)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return buf.String()
+}
+
+// ParseWithHeadings is like Parse, but also returns the headings of the document in order.
+// Images that could not be processed are left as they are and reported as ImageErrors,
+// the HTML and headings are returned nonetheless.
+func (p *Parser) ParseWithHeadings(s string) (string, []Heading, error) {
+	source := []byte(s)
+
+	pc := parser.NewContext()
+	pc.Set(imageDirKey, p.imageDir)
+	doc := p.markdown.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+
+	headings := make([]Heading, 0)
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		id, _ := heading.AttributeString("id")
+		idBytes, _ := id.([]byte)
+
+		headings = append(headings, Heading{
+			Level: heading.Level,
+			Id:    string(idBytes),
+			Title: nodeText(heading, source),
+		})
+
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
 
 	buf := new(bytes.Buffer)
-	if err := markdown.Convert([]byte(s), buf); err != nil {
-		return "", err
+	if err := p.markdown.Renderer().Render(buf, source, doc); err != nil {
+		return "", nil, err
 	}
 
-	return buf.String(), nil
+	return buf.String(), headings, imageErrors(pc)
 }
@@ -0,0 +1,87 @@
+package markdown
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// WikiLinkScheme prefixes the URLs of wiki links ([[target]] or [[target|text]]) in the generated HTML.
+// The targets are articles or pages, they can only be resolved once all of them are known.
+const WikiLinkScheme = "wiki:"
+
+// WikiLinkTarget returns the target of a wiki link URL
+func WikiLinkTarget(href string) (string, bool) {
+	if !strings.HasPrefix(href, WikiLinkScheme) {
+		return "", false
+	}
+
+	target, err := url.PathUnescape(strings.TrimPrefix(href, WikiLinkScheme))
+	if err != nil {
+		return "", false
+	}
+
+	return target, true
+}
+
+var (
+	wikiLinkOpen  = []byte("[[")
+	wikiLinkClose = []byte("]]")
+)
+
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, wikiLinkOpen) {
+		return nil
+	}
+
+	end := bytes.Index(line[len(wikiLinkOpen):], wikiLinkClose)
+	if end < 0 {
+		return nil
+	}
+	content := line[len(wikiLinkOpen) : len(wikiLinkOpen)+end]
+
+	// [[text]](url) is a regular link whose text happens to be in brackets
+	if rest := line[len(wikiLinkOpen)+end+len(wikiLinkClose):]; len(rest) > 0 && rest[0] == '(' {
+		return nil
+	}
+
+	target, label := content, content
+	if i := bytes.IndexByte(content, '|'); i >= 0 {
+		target, label = content[:i], content[i+1:]
+	}
+
+	target = bytes.TrimSpace(target)
+	label = bytes.TrimSpace(label)
+	if len(target) == 0 || len(label) == 0 || bytes.ContainsAny(target, "[]") {
+		return nil
+	}
+
+	block.Advance(len(wikiLinkOpen) + end + len(wikiLinkClose))
+
+	link := ast.NewLink()
+	link.Destination = append([]byte(WikiLinkScheme), target...)
+	link.AppendChild(link, ast.NewString(append([]byte(nil), label...)))
+	return link
+}
+
+type wikiLinks struct{}
+
+func (wikiLinks) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		// Before the parser for regular links, which is also triggered by '['
+		util.Prioritized(wikiLinkParser{}, 199),
+	))
+}
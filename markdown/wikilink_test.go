@@ -0,0 +1,56 @@
+package markdown
+
+import "testing"
+
+func TestWikiLinks(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"[[hello]]", `<p><a href="wiki:hello">hello</a></p>`},
+		{"See [[ hello | the post ]].", `<p>See <a href="wiki:hello">the post</a>.</p>`},
+		{"[[two words]]", `<p><a href="wiki:two%20words">two words</a></p>`},
+		{"[[a]] and [[b|B]]", `<p><a href="wiki:a">a</a> and <a href="wiki:b">B</a></p>`},
+		{"[[text]](https://example.com/)", `<p><a href="https://example.com/">[text]</a></p>`},
+		{"[[|label]] [[target|]] [[]]", `<p>[[|label]] [[target|]] [[]]</p>`},
+		{"[[not closed", `<p>[[not closed</p>`},
+		{"`[[code]]`", `<p><code>[[code]]</code></p>`},
+		{"[regular](/link)", `<p><a href="/link">regular</a></p>`},
+	}
+
+	p, err := New(Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		html, err := p.Parse(test.in)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", test.in, err)
+			continue
+		}
+
+		if want := test.want + "\n"; html != want {
+			t.Errorf("Parse(%q) = %q, want %q", test.in, html, want)
+		}
+	}
+}
+
+func TestWikiLinkTarget(t *testing.T) {
+	tests := []struct {
+		href, want string
+		ok         bool
+	}{
+		{"wiki:hello", "hello", true},
+		{"wiki:two%20words", "two words", true},
+		{"wiki:bad%zz", "", false},
+		{"/blog/q/hello", "", false},
+		{"https://example.com/wiki:hello", "", false},
+	}
+
+	for _, test := range tests {
+		target, ok := WikiLinkTarget(test.href)
+		if target != test.want || ok != test.ok {
+			t.Errorf("WikiLinkTarget(%q) = %q, %t, want %q, %t", test.href, target, ok, test.want, test.ok)
+		}
+	}
+}
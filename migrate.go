@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"code.laria.me/laria.me/environment"
+	"code.laria.me/laria.me/store"
+)
+
+// requireCurrentSchema exits, if the database schema is not up to date
+func requireCurrentSchema(progname string, env *environment.Env) {
+	st, err := env.Store()
+	if err != nil {
+		log.Fatalf("Could not open store: %s", err)
+	}
+
+	pending, err := store.PendingMigrations(st)
+	if err != nil {
+		log.Fatalf("Could not check the database schema: %s", err)
+	}
+
+	if len(pending) > 0 {
+		log.Fatalf("The database schema is behind by %d migration(s), run \"%s migrate\" first", len(pending), progname)
+	}
+}
+
+func migrateStatus(st store.Store) {
+	migrations, err := st.Migrations()
+	if err != nil {
+		log.Fatalf("Could not read schema migrations: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\t")
+	for _, m := range migrations {
+		status := "pending"
+		if m.Applied {
+			status = "applied"
+		}
+
+		fmt.Fprintf(w, "%04d\t%s\t%s\t\n", m.Version, m.Name, status)
+	}
+	w.Flush()
+}
+
+func cmdMigrate(progname string, env *environment.Env, args []string) {
+	st, err := env.Store()
+	if err != nil {
+		log.Fatalf("env.Store() failed: %s", err)
+	}
+
+	if len(args) > 0 {
+		if args[0] != "status" {
+			fmt.Fprintf(os.Stderr, "Usage: %s migrate [status]\n", progname)
+			os.Exit(1)
+		}
+
+		migrateStatus(st)
+		return
+	}
+
+	applied, err := st.Migrate()
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatalf("Migration failed: %s", err)
+	}
+
+	if len(applied) == 0 {
+		log.Println("Schema is up to date")
+	}
+}
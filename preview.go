@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.laria.me/laria.me/config"
+	"code.laria.me/laria.me/environment"
+	"code.laria.me/laria.me/store"
+)
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshotFiles records the modification times and sizes of all files in (or at) the given paths
+func snapshotFiles(paths []string) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+
+	for _, root := range paths {
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() {
+				stamps[p] = fileStamp{info.ModTime(), info.Size()}
+			}
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stamps, nil
+}
+
+func sameSnapshot(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for p, stampA := range a {
+		stampB, ok := b[p]
+		if !ok || !stampA.modTime.Equal(stampB.modTime) || stampA.size != stampB.size {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reloadBroker notifies connected browsers about changes using server-sent events
+type reloadBroker struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func newReloadBroker() *reloadBroker {
+	return &reloadBroker{clients: make(map[chan struct{}]struct{})}
+}
+
+func (b *reloadBroker) subscribe() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	b.clients[ch] = struct{}{}
+	return ch
+}
+
+func (b *reloadBroker) unsubscribe(ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.clients, ch)
+}
+
+func (b *reloadBroker) broadcast() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.clients {
+		select {
+		case ch <- struct{}{}:
+		default: // A reload is already pending for this client
+		}
+	}
+}
+
+func (b *reloadBroker) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	ch := b.subscribe()
+	defer b.unsubscribe(ch)
+
+	for {
+		select {
+		case <-ch:
+			if _, err := fmt.Fprint(w, "event: reload\ndata: \n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+const previewEventsPath = "/__preview/events"
+
+const previewScript = `<script>new EventSource("` + previewEventsPath + `").addEventListener("reload", function() { location.reload(); });</script>`
+
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header         { return w.header }
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *bufferedResponseWriter) WriteHeader(statusCode int)  { w.code = statusCode }
+
+// injectReloadScript adds a script to all HTML responses that reloads the page when the content changes
+func injectReloadScript(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == previewEventsPath || strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &bufferedResponseWriter{header: w.Header(), code: 200}
+		next.ServeHTTP(bw, r)
+
+		body := bw.buf.Bytes()
+
+		contentType := w.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+
+		if strings.HasPrefix(contentType, "text/html") {
+			if i := bytes.LastIndex(body, []byte("</body>")); i >= 0 {
+				body = append(body[:i:i], append([]byte(previewScript), body[i:]...)...)
+			} else {
+				body = append(body, previewScript...)
+			}
+			w.Header().Set("Content-Type", contentType)
+		}
+
+		w.Header().Del("Content-Length")
+		w.WriteHeader(bw.code)
+		w.Write(body)
+	})
+}
+
+type previewServer struct {
+	conf   *config.Config
+	ctx    *serveContext
+	store  *store.Memory
+	broker *reloadBroker
+}
+
+// watchedPaths returns all files and directories the preview depends on
+func (p *previewServer) watchedPaths() []string {
+	paths := append([]string{}, p.conf.ArticleDirs...)
+	return append(paths,
+		path.Join(p.conf.ContentRoot, "pages"),
+		path.Join(p.conf.ContentRoot, "menu.json"),
+		p.conf.TemplatePath,
+	)
+}
+
+func (p *previewServer) reload() error {
+	md, err := p.ctx.env.Markdown()
+	if err != nil {
+		return err
+	}
+
+	articles, err := loadAllArticles(p.conf, md)
+	if err != nil {
+		return err
+	}
+
+	// Pages resolve their wiki links against the store, so the new articles
+	// must be in place before the pages are reloaded.
+	p.store.Replace(articles)
+	return p.ctx.update()
+}
+
+func (p *previewServer) watch(interval time.Duration) {
+	last, err := snapshotFiles(p.watchedPaths())
+	if err != nil {
+		log.Printf("Could not check for changes: %s", err)
+	}
+
+	for range time.Tick(interval) {
+		cur, err := snapshotFiles(p.watchedPaths())
+		if err != nil {
+			log.Printf("Could not check for changes: %s", err)
+			continue
+		}
+
+		if sameSnapshot(last, cur) {
+			continue
+		}
+		last = cur
+
+		if err := p.reload(); err != nil {
+			log.Printf("Reloading failed: %s", err)
+			continue
+		}
+
+		log.Println("Content changed, reloading")
+		p.broker.broadcast()
+	}
+}
+
+// cmdPreview serves the site directly from the content directory, without a database.
+// Hidden and future articles are shown as drafts and open pages reload when something changes.
+func cmdPreview(progname string, env *environment.Env, args []string) {
+	conf, err := env.Config()
+	if err != nil {
+		log.Fatalf("Could not load config: %s", err)
+	}
+
+	flagSet := flag.NewFlagSet(progname+" preview", flag.ExitOnError)
+	laddr := flagSet.String("laddr", conf.HttpLaddr, "The address to listen on")
+	interval := flagSet.Duration("interval", 500*time.Millisecond, "How often to check for changes")
+	flagSet.Parse(args)
+
+	st := store.NewMemory(true)
+
+	ctx, err := newServeContext(env, st)
+	if err != nil {
+		log.Fatalf("Could not create serveContext: %s", err)
+	}
+
+	p := &previewServer{
+		conf:   conf,
+		ctx:    ctx,
+		store:  st,
+		broker: newReloadBroker(),
+	}
+
+	if err := p.reload(); err != nil {
+		log.Fatalf("Could not load content: %s", err)
+	}
+
+	go p.watch(*interval)
+
+	r := ctx.router(conf.StaticPath)
+	r.HandleFunc(previewEventsPath, p.broker.handleEvents)
+
+	log.Printf("Serving preview on %s", *laddr)
+	if err := http.ListenAndServe(*laddr, injectReloadScript(r)); err != nil {
+		log.Fatalln(err)
+	}
+}
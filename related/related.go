@@ -0,0 +1,151 @@
+// Package related finds related articles by comparing their tags and texts.
+package related
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"code.laria.me/laria.me/article"
+)
+
+const (
+	tagWeight  = 0.5
+	textWeight = 0.5
+
+	// Words shorter than this are mostly stop words and don't tell much about the topic
+	minWordLength = 4
+)
+
+// vector is a sparse, normalized vector of term weights
+type vector map[string]float64
+
+func (a vector) dot(b vector) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+
+	sum := 0.0
+	for term, wa := range a {
+		sum += wa * b[term]
+	}
+	return sum
+}
+
+func termFrequencies(text string) map[string]int {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	tf := make(map[string]int)
+	for _, word := range words {
+		if len([]rune(word)) >= minWordLength {
+			tf[word]++
+		}
+	}
+	return tf
+}
+
+// textVectors builds TF-IDF vectors of the titles and texts of the articles
+func textVectors(articles []article.Article) []vector {
+	tfs := make([]map[string]int, 0, len(articles))
+	df := make(map[string]int)
+
+	for _, a := range articles {
+		tf := termFrequencies(a.Title + " " + a.FullPlain)
+		for term := range tf {
+			df[term]++
+		}
+		tfs = append(tfs, tf)
+	}
+
+	n := float64(len(articles))
+	vectors := make([]vector, 0, len(articles))
+	for _, tf := range tfs {
+		v := make(vector)
+		norm := 0.0
+		for term, count := range tf {
+			w := float64(count) * math.Log(n/float64(df[term]))
+			if w > 0 {
+				v[term] = w
+				norm += w * w
+			}
+		}
+
+		norm = math.Sqrt(norm)
+		for term := range v {
+			v[term] /= norm
+		}
+
+		vectors = append(vectors, v)
+	}
+
+	return vectors
+}
+
+// tagOverlap is the Jaccard index of two tag sets
+func tagOverlap(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for tag := range a {
+		if _, ok := b[tag]; ok {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+type candidate struct {
+	index int
+	score float64
+}
+
+// Assign sets the Related field of every article to the slugs of at most n related articles, most related first.
+// Only articles that are public at now (as returned by article.WallClock) are related, so hidden and scheduled
+// articles don't take the place of visible ones.
+func Assign(articles []article.Article, n int, now time.Time) {
+	vectors := textVectors(articles)
+
+	for i := range articles {
+		candidates := make([]candidate, 0, len(articles))
+
+		for j := range articles {
+			if i == j || !articles[j].IsPublic(now) {
+				continue
+			}
+
+			score := tagWeight*tagOverlap(articles[i].Tags, articles[j].Tags) + textWeight*vectors[i].dot(vectors[j])
+			if score > 0 {
+				candidates = append(candidates, candidate{j, score})
+			}
+		}
+
+		sort.Slice(candidates, func(a, b int) bool {
+			ca, cb := candidates[a], candidates[b]
+			if ca.score != cb.score {
+				return ca.score > cb.score
+			}
+			// Prefer newer articles on a tie, then sort by slug so the order is stable
+			pa, pb := articles[ca.index], articles[cb.index]
+			if !pa.Published.Equal(pb.Published) {
+				return pa.Published.After(pb.Published)
+			}
+			return pa.Slug < pb.Slug
+		})
+
+		if len(candidates) > n {
+			candidates = candidates[:n]
+		}
+
+		articles[i].Related = make([]string, 0, len(candidates))
+		for _, c := range candidates {
+			articles[i].Related = append(articles[i].Related, articles[c.index].Slug)
+		}
+	}
+}
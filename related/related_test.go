@@ -0,0 +1,72 @@
+package related
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"code.laria.me/laria.me/article"
+)
+
+func date(y, m, d int) time.Time {
+	return time.Date(y, time.Month(m), d, 10, 0, 0, 0, time.UTC)
+}
+
+func tags(names ...string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	return set
+}
+
+func TestAssign(t *testing.T) {
+	articles := []article.Article{
+		{Slug: "go-intro", Published: date(2020, 1, 1), Tags: tags("go", "web")},
+		{Slug: "go-web", Published: date(2020, 2, 1), Tags: tags("go", "web")},
+		{Slug: "go-tools", Published: date(2020, 3, 1), Tags: tags("go")},
+		// Same tags and publication date as go-tools, the slug breaks the tie
+		{Slug: "go-alpha", Published: date(2020, 3, 1), Tags: tags("go")},
+		{Slug: "cooking", Published: date(2020, 4, 1), Tags: tags("food")},
+		{Slug: "go-draft", Published: date(2020, 5, 1), Tags: tags("go", "web"), Hidden: true},
+		{Slug: "go-future", Published: date(2999, 1, 1), Tags: tags("go", "web")},
+	}
+
+	Assign(articles, 3, date(2021, 1, 1))
+
+	tests := []struct {
+		slug string
+		want []string
+	}{
+		{"go-intro", []string{"go-web", "go-alpha", "go-tools"}},
+		{"go-tools", []string{"go-alpha", "go-web", "go-intro"}},
+		{"cooking", []string{}},
+		// Unpublished articles still get related articles for when they are published
+		{"go-draft", []string{"go-web", "go-intro", "go-alpha"}},
+	}
+
+	bySlug := make(map[string]article.Article)
+	for _, a := range articles {
+		bySlug[a.Slug] = a
+	}
+
+	for _, test := range tests {
+		if got := bySlug[test.slug].Related; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got related %v, want %v", test.slug, got, test.want)
+		}
+	}
+}
+
+func TestAssignText(t *testing.T) {
+	articles := []article.Article{
+		{Slug: "parser", Title: "Writing a parser", FullPlain: "Tokenizer and grammar for a parser"},
+		{Slug: "lexer", Title: "Writing a lexer", FullPlain: "The tokenizer splits input for the grammar"},
+		{Slug: "garden", Title: "My garden", FullPlain: "Tomatoes and potatoes"},
+	}
+
+	Assign(articles, 10, date(2021, 1, 1))
+
+	if got, want := articles[0].Related, []string{"lexer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got related %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,253 @@
+// Package sanitize removes everything from HTML that is not explicitly allowed.
+package sanitize
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Policy is an allowlist of HTML elements and attributes
+type Policy struct {
+	// Elements maps the names of the allowed elements to their allowed attributes.
+	// The attributes of the pseudo element "*" are allowed for all elements.
+	Elements map[string][]string
+	// UrlSchemes are the allowed schemes of URLs in href, src and srcset attributes. Relative URLs are always allowed.
+	UrlSchemes []string
+}
+
+// DefaultPolicy allows the elements Markdown produces and some harmless extras, but no scripts, styles or embeds
+var DefaultPolicy = Policy{
+	Elements: map[string][]string{
+		"*":          {"id", "class", "title", "lang"},
+		"a":          {"href", "rel"},
+		"abbr":       {},
+		"b":          {},
+		"blockquote": {"cite"},
+		"br":         {},
+		"caption":    {},
+		"code":       {},
+		"dd":         {},
+		"del":        {},
+		"details":    {"open"},
+		"div":        {},
+		"dl":         {},
+		"dt":         {},
+		"em":         {},
+		"figcaption": {},
+		"figure":     {},
+		"h1":         {},
+		"h2":         {},
+		"h3":         {},
+		"h4":         {},
+		"h5":         {},
+		"h6":         {},
+		"hr":         {},
+		"i":          {},
+		"img":        {"src", "srcset", "sizes", "alt", "width", "height", "loading", "decoding"},
+		"input":      {"type", "checked", "disabled"}, // Task lists
+		"ins":        {},
+		"kbd":        {},
+		"li":         {},
+		"mark":       {},
+		"ol":         {"start"},
+		"p":          {},
+		"pre":        {},
+		"q":          {"cite"},
+		"s":          {},
+		"samp":       {},
+		"small":      {},
+		"span":       {},
+		"strong":     {},
+		"sub":        {},
+		"summary":    {},
+		"sup":        {},
+		"table":      {},
+		"tbody":      {},
+		"td":         {"colspan", "rowspan", "align"},
+		"tfoot":      {},
+		"th":         {"colspan", "rowspan", "align"},
+		"thead":      {},
+		"tr":         {},
+		"u":          {},
+		"ul":         {},
+		"var":        {},
+	},
+	UrlSchemes: []string{"http", "https", "mailto"},
+}
+
+// Elements whose content is removed together with them, instead of keeping the content
+var dropWithContent = map[atom.Atom]struct{}{
+	atom.Script:   {},
+	atom.Style:    {},
+	atom.Iframe:   {},
+	atom.Object:   {},
+	atom.Embed:    {},
+	atom.Template: {},
+	atom.Noscript: {},
+	atom.Textarea: {},
+	atom.Select:   {},
+}
+
+type sanitizer struct {
+	policy  Policy
+	removed map[string]int
+}
+
+func (s *sanitizer) report(format string, args ...interface{}) {
+	s.removed[fmt.Sprintf(format, args...)]++
+}
+
+func (s *sanitizer) attributeAllowed(element string, attr html.Attribute) bool {
+	if attr.Namespace != "" {
+		return false
+	}
+
+	allowed := false
+	for _, list := range [][]string{s.policy.Elements[element], s.policy.Elements["*"]} {
+		for _, name := range list {
+			if strings.EqualFold(name, attr.Key) {
+				allowed = true
+			}
+		}
+	}
+
+	if !allowed {
+		return false
+	}
+
+	switch strings.ToLower(attr.Key) {
+	case "href", "src", "cite":
+		return s.urlAllowed(attr.Val)
+	case "srcset":
+		return s.srcsetAllowed(attr.Val)
+	}
+
+	return true
+}
+
+// srcsetAllowed checks every URL of a srcset attribute, a comma separated list of URLs,
+// each optionally followed by a descriptor
+func (s *sanitizer) srcsetAllowed(srcset string) bool {
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 || !s.urlAllowed(fields[0]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *sanitizer) urlAllowed(rawUrl string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil {
+		return false
+	}
+
+	if u.Scheme == "" {
+		return true
+	}
+
+	for _, scheme := range s.policy.UrlSchemes {
+		if strings.EqualFold(scheme, u.Scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *sanitizer) cleanAttributes(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		if s.attributeAllowed(n.Data, attr) {
+			attrs = append(attrs, attr)
+		} else {
+			s.report("attribute %s of <%s>", attr.Key, n.Data)
+		}
+	}
+	n.Attr = attrs
+}
+
+// clean sanitizes the children of n
+func (s *sanitizer) clean(n *html.Node) {
+	c := n.FirstChild
+	for c != nil {
+		next := c.NextSibling
+
+		switch c.Type {
+		case html.ElementNode:
+			s.clean(c)
+
+			if _, ok := s.policy.Elements[c.Data]; ok {
+				s.cleanAttributes(c)
+				break
+			}
+
+			if _, ok := dropWithContent[c.DataAtom]; ok {
+				s.report("<%s> element with its content", c.Data)
+			} else {
+				s.report("<%s> element", c.Data)
+
+				// Keep the already cleaned content
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+			}
+
+			n.RemoveChild(c)
+		case html.TextNode:
+		default:
+			// Comments, doctypes, ...
+			n.RemoveChild(c)
+		}
+
+		c = next
+	}
+}
+
+// Sanitize removes all elements and attributes from an HTML fragment that the policy doesn't allow.
+// Also returns descriptions of what was removed.
+func (p Policy) Sanitize(s string) (string, []string, error) {
+	body := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	}
+
+	nodes, err := html.ParseFragment(strings.NewReader(s), body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+
+	san := &sanitizer{policy: p, removed: make(map[string]int)}
+	san.clean(body)
+
+	buf := new(strings.Builder)
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(buf, c); err != nil {
+			return "", nil, err
+		}
+	}
+
+	removed := make([]string, 0, len(san.removed))
+	for what, count := range san.removed {
+		if count > 1 {
+			what = fmt.Sprintf("%s (%d times)", what, count)
+		}
+		removed = append(removed, what)
+	}
+	sort.Strings(removed)
+
+	return buf.String(), removed, nil
+}
@@ -0,0 +1,100 @@
+package sanitize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		removed []string
+	}{
+		{
+			name: "allowed",
+			in:   `<p class="x">Some <em>text</em> with <a href="https://example.com/" rel="nofollow">a link</a></p>`,
+			want: `<p class="x">Some <em>text</em> with <a href="https://example.com/" rel="nofollow">a link</a></p>`,
+		},
+		{
+			name:    "script with content",
+			in:      `<p>before</p><script>alert(1)</script><p>after</p>`,
+			want:    `<p>before</p><p>after</p>`,
+			removed: []string{"<script> element with its content"},
+		},
+		{
+			name:    "unknown element keeps content",
+			in:      `<p><font color="red">red <b>bold</b></font></p>`,
+			want:    `<p>red <b>bold</b></p>`,
+			removed: []string{"<font> element"},
+		},
+		{
+			name:    "event handlers",
+			in:      `<p onclick="evil()">a</p><b onmouseover="evil()">b</b>`,
+			want:    `<p>a</p><b>b</b>`,
+			removed: []string{"attribute onclick of <p>", "attribute onmouseover of <b>"},
+		},
+		{
+			name:    "javascript urls",
+			in:      `<a href="javascript:evil()">a</a><a href=" JavaScript:evil()">b</a><a href="/relative">c</a>`,
+			want:    `<a>a</a><a>b</a><a href="/relative">c</a>`,
+			removed: []string{"attribute href of <a> (2 times)"},
+		},
+		{
+			name: "responsive images",
+			in:   `<img src="a.png" srcset="a-320.png 320w, https://example.com/a-640.png 640w" sizes="100vw" loading="lazy" decoding="async" width="10" height="5"/>`,
+			want: `<img src="a.png" srcset="a-320.png 320w, https://example.com/a-640.png 640w" sizes="100vw" loading="lazy" decoding="async" width="10" height="5"/>`,
+		},
+		{
+			name:    "javascript in srcset",
+			in:      `<img src="a.png" srcset="a.png 1x, javascript:evil() 2x"/><img srcset=", "/>`,
+			want:    `<img src="a.png"/><img/>`,
+			removed: []string{"attribute srcset of <img> (2 times)"},
+		},
+		{
+			name:    "comments",
+			in:      `<p>a<!-- secret --></p>`,
+			want:    `<p>a</p>`,
+			removed: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		got, removed, err := DefaultPolicy.Sanitize(test.in)
+		if err != nil {
+			t.Errorf("%s: Sanitize failed: %s", test.name, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+
+		if test.removed == nil {
+			test.removed = []string{}
+		}
+		if !reflect.DeepEqual(removed, test.removed) {
+			t.Errorf("%s: got removed %q, want %q", test.name, removed, test.removed)
+		}
+	}
+}
+
+func TestSanitizeCustomPolicy(t *testing.T) {
+	policy := Policy{
+		Elements: map[string][]string{
+			"p": {},
+			"a": {"href"},
+		},
+		UrlSchemes: []string{"https"},
+	}
+
+	got, _, err := policy.Sanitize(`<p id="x"><a href="http://example.com/">http</a> <a href="https://example.com/">https</a></p><em>em</em>`)
+	if err != nil {
+		t.Fatalf("Sanitize failed: %s", err)
+	}
+
+	if want := `<p><a>http</a> <a href="https://example.com/">https</a></p>em`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"code.laria.me/laria.me/environment"
+)
+
+func cmdScheduled(progname string, env *environment.Env, args []string) {
+	st, err := env.Store()
+	if err != nil {
+		log.Fatalf("env.Store() failed: %s", err)
+	}
+
+	articles, err := st.Scheduled()
+	if err != nil {
+		log.Fatalf("Could not list scheduled articles: %s", err)
+	}
+
+	if len(articles) == 0 {
+		fmt.Println("No articles are scheduled")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PUBLISHED\tSLUG\tTITLE\t")
+	for _, a := range articles {
+		title := a.Title
+		if a.Hidden {
+			title += " (hidden)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", a.Published.Format("2006-01-02 15:04:05"), a.Slug, title)
+	}
+	w.Flush()
+}
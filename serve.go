@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -16,31 +15,41 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 
+	"code.laria.me/laria.me/article"
 	"code.laria.me/laria.me/atom"
-	"code.laria.me/laria.me/dbutils"
+	"code.laria.me/laria.me/config"
 	"code.laria.me/laria.me/environment"
+	"code.laria.me/laria.me/htmltransform"
 	"code.laria.me/laria.me/markdown"
 	"code.laria.me/laria.me/menu"
+	"code.laria.me/laria.me/store"
 )
 
 type serveContext struct {
 	env     *environment.Env
+	store   store.Store
 	rwMutex *sync.RWMutex
 	pages   map[string]template.HTML
 	menu    *menu.Menu
 	views   Views
+	// pageLinks maps the slugs and aliases of articles to the names of the pages linking to them
+	pageLinks map[string][]string
+	// syntaxCss is the generated stylesheet for highlighted code, if it should be served from memory
+	syntaxCss []byte
 }
 
-func newServeContext(env *environment.Env) (*serveContext, error) {
+func newServeContext(env *environment.Env, st store.Store) (*serveContext, error) {
 	context := &serveContext{
 		env:     env,
+		store:   st,
 		rwMutex: new(sync.RWMutex),
 		pages:   make(map[string]template.HTML),
 	}
@@ -61,7 +70,7 @@ func pageName(filename string) string {
 	return m[1]
 }
 
-func loadPage(filename string) (template.HTML, error) {
+func loadPage(filename string, md *markdown.Parser) (template.HTML, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return "", err
@@ -74,11 +83,13 @@ func loadPage(filename string) (template.HTML, error) {
 		return "", err
 	}
 
-	html, err := markdown.Parse(buf.String())
+	html, err := md.Parse(buf.String())
 	return template.HTML(html), err
 }
 
-func readPages(pagesPath string) (map[string]template.HTML, error) {
+// readPages loads all pages in pagesPath, resolving wiki links with linkTargets and
+// sanitizing the ones the config marks as untrusted
+func readPages(pagesPath string, md *markdown.Parser, conf *config.Config, linkTargets map[string]string) (map[string]template.HTML, error) {
 	f, err := os.Open(pagesPath)
 	if err != nil {
 		return nil, err
@@ -101,10 +112,38 @@ func readPages(pagesPath string) (map[string]template.HTML, error) {
 			continue
 		}
 
-		html, err := loadPage(filepath.Join(pagesPath, info.Name()))
+		filename := filepath.Join(pagesPath, info.Name())
+
+		html, err := loadPage(filename, md)
+
+		// Images that could not be processed are left as they are, which shouldn't make the page unavailable
+		var imageErrs markdown.ImageErrors
+		if errors.As(err, &imageErrs) {
+			for _, imageErr := range imageErrs {
+				log.Printf("%s: %s", filename, imageErr)
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		resolved, _, err := resolveWikiLinks(string(html), linkTargets, quicklinkFallback(filename))
 		if err != nil {
 			return nil, err
 		}
+		html = template.HTML(resolved)
+
+		if conf.IsUntrusted(filename) {
+			sanitized, removed, err := conf.SanitizePolicy().Sanitize(string(html))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, what := range removed {
+				log.Printf("%s: removed %s", filename, what)
+			}
+
+			html = template.HTML(sanitized)
+		}
 
 		pages[name] = html
 	}
@@ -112,6 +151,39 @@ func readPages(pagesPath string) (map[string]template.HTML, error) {
 	return pages, nil
 }
 
+// pageArticleLinks finds the links from pages to articles. Returns a map from the linked slugs
+// and aliases to the names of the linking pages, ordered by name.
+func pageArticleLinks(pages map[string]template.HTML) (map[string][]string, error) {
+	names := make([]string, 0, len(pages))
+	for name := range pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	links := make(map[string][]string)
+	for _, name := range names {
+		hrefs, err := htmltransform.Links(string(pages[name]))
+		if err != nil {
+			return nil, fmt.Errorf("page %s: %w", name, err)
+		}
+
+		seen := make(map[string]struct{})
+		for _, href := range hrefs {
+			linked, ok := linkedArticleName(href)
+			if !ok {
+				continue
+			}
+
+			if _, ok := seen[linked]; !ok {
+				seen[linked] = struct{}{}
+				links[linked] = append(links[linked], name)
+			}
+		}
+	}
+
+	return links, nil
+}
+
 func (ctx *serveContext) update() error {
 	conf, err := ctx.env.Config()
 	if err != nil {
@@ -124,22 +196,48 @@ func (ctx *serveContext) update() error {
 		return fmt.Errorf("Failed loading menu %s: %w", menuPath, err)
 	}
 
+	md, err := ctx.env.Markdown()
+	if err != nil {
+		return err
+	}
+
 	pagesPath := path.Join(conf.ContentRoot, "pages")
-	pages, err := readPages(pagesPath)
+	linkTargets, err := pageWikiLinkTargets(pagesPath, ctx.store)
+	if err != nil {
+		return fmt.Errorf("Failed loading wiki link targets: %w", err)
+	}
+
+	pages, err := readPages(pagesPath, md, conf, linkTargets)
 	if err != nil {
 		return fmt.Errorf("Failed loading pages from %s: %w", pagesPath, err)
 	}
 
+	pageLinks, err := pageArticleLinks(pages)
+	if err != nil {
+		return fmt.Errorf("Failed finding links in pages: %w", err)
+	}
+
 	views, err := LoadViews(conf.TemplatePath)
 	if err != nil {
 		return fmt.Errorf("Failed loading templates: %w", err)
 	}
 
+	var syntaxCss []byte
+	if conf.HighlightCss.Serve {
+		buf := new(bytes.Buffer)
+		if err := markdown.WriteHighlightCss(buf, conf.Markdown.HighlightStyle, conf.HighlightCss.DarkStyle); err != nil {
+			return fmt.Errorf("Failed generating syntax.css: %w", err)
+		}
+		syntaxCss = buf.Bytes()
+	}
+
 	ctx.rwMutex.Lock()
 	defer ctx.rwMutex.Unlock()
 
+	ctx.syntaxCss = syntaxCss
 	ctx.menu = menu
 	ctx.pages = pages
+	ctx.pageLinks = pageLinks
 	ctx.views = views
 
 	return nil
@@ -175,126 +273,51 @@ func (ctx *serveContext) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
-var reHtmlHeadline = regexp.MustCompile(`<\s*h\d\b`)
-
-func rewriteHeadlines(html template.HTML, sub int) template.HTML {
-	if sub == 0 {
-		return html
-	}
-
-	str := string(html)
-	str = reHtmlHeadline.ReplaceAllStringFunc(str, func(s string) string {
-		_n, _ := strconv.ParseInt(s[len(s)-1:], 10, 8)
-		n := int(_n)
-		n -= sub
-		if n < 1 {
-			n = 1
-		}
-		if n > 6 {
-			n = 6
-		}
-
-		return fmt.Sprintf("<h%d", n)
-	})
-	return template.HTML(str)
-}
+// minTocEntries is the number of headings an article needs to get a table of contents
+const minTocEntries = 3
 
-// viewArticlesFromDb creates ViewArticles from an SQL query.
-// The quey should select these values: ID, Published, Slug, Title, Content, ReadMore
-func viewArticlesFromDb(db *sql.DB, headlineSub int, query string, args ...interface{}) ([]ViewArticle, int, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, 0, err
+// viewArticle creates a ViewArticle from an article. If summary is set, the article is shown in a list
+// and the summary (if there is one) will be used as content.
+func viewArticle(a article.Article, summary bool) ViewArticle {
+	va := ViewArticle{
+		Published:      a.Published,
+		Updated:        a.Updated,
+		Slug:           a.Slug,
+		Title:          a.Title,
+		Content:        template.HTML(a.FullHtml),
+		Tags:           make([]string, 0, len(a.Tags)),
+		Extra:          a.Extra,
+		WordCount:      a.WordCount,
+		ReadingMinutes: int(math.Ceil(a.ReadingTime.Minutes())),
+		Draft:          !a.IsPublic(article.WallClock(time.Now())),
 	}
 
-	articles, count, err := viewArticlesFromDbTx(tx, headlineSub, query, args...)
-	err = dbutils.TxCommitIfOk(tx, err)
-	return articles, count, err
-}
-
-func viewArticlesFromDbTx(tx *sql.Tx, headlineSub int, query string, args ...interface{}) ([]ViewArticle, int, error) {
-	rows, err := tx.Query(query, args...)
-	if err != nil {
-		return nil, 0, err
+	if summary {
+		va.Content = template.HTML(a.ListHtml)
+		va.ReadMore = a.SummaryHtml != ""
+	} else if article.CountTocEntries(a.Toc) >= minTocEntries {
+		va.Toc = a.Toc
 	}
-	defer rows.Close()
-
-	ids := make([]int, 0)
-	articlesById := make(map[int]*ViewArticle)
-	for rows.Next() {
-		var va ViewArticle
-		var id int
-
-		var t mysql.NullTime
-
-		if err := rows.Scan(
-			&id,
-			&t,
-			&va.Slug,
-			&va.Title,
-			&va.Content,
-			&va.ReadMore,
-		); err != nil {
-			return nil, 0, err
-		}
-
-		if t.Valid {
-			va.Published = t.Time
-		}
 
-		va.Content = rewriteHeadlines(va.Content, headlineSub)
-
-		ids = append(ids, id)
-		articlesById[id] = &va
+	for tag := range a.Tags {
+		va.Tags = append(va.Tags, tag)
 	}
+	sort.Strings(va.Tags)
 
-	if err = rows.Err(); err != nil {
-		return nil, 0, err
-	}
+	return va
+}
 
-	var total int
-	err = tx.QueryRow(`SELECT FOUND_ROWS()`).Scan(&total)
+// viewArticlesFromStore creates ViewArticles from the articles matching the filter.
+// Also returns the total number of matching articles.
+func viewArticlesFromStore(st store.Store, summary bool, filter store.Filter) ([]ViewArticle, int, error) {
+	articles, total, err := st.Articles(filter)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	if len(ids) > 0 {
-		inSql, inArgs := dbutils.BuildInIdsSqlAndArgs("article_id", ids)
-
-		rows, err := tx.Query(`
-			SELECT article_id, tag
-			FROM article_tag
-			WHERE `+inSql+`
-			ORDER BY article_id, tag
-		`, inArgs...)
-
-		if err != nil {
-			return nil, 0, err
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var id int
-			var tag string
-
-			if err := rows.Scan(&id, &tag); err != nil {
-				return nil, 0, err
-			}
-
-			article, ok := articlesById[id]
-			if ok {
-				article.Tags = append(article.Tags, tag)
-			}
-		}
-
-		if err := rows.Err(); err != nil {
-			return nil, 0, err
-		}
-	}
-
-	viewArticles := make([]ViewArticle, 0, len(ids))
-	for _, id := range ids {
-		viewArticles = append(viewArticles, *articlesById[id])
+	viewArticles := make([]ViewArticle, 0, len(articles))
+	for _, a := range articles {
+		viewArticles = append(viewArticles, viewArticle(a, summary))
 	}
 
 	return viewArticles, total, nil
@@ -349,161 +372,346 @@ func wrapHandleFunc(
 }
 
 func (ctx *serveContext) handleArticle(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
-	if err != nil {
-		return err
-	}
-
 	vars := mux.Vars(r)
 	year, _ := strconv.Atoi(vars["year"])
 	month, _ := strconv.Atoi(vars["month"])
 	day, _ := strconv.Atoi(vars["day"])
 	slug := vars["slug"]
 
-	articles, _, err := viewArticlesFromDb(db, 0, `
-		SELECT article_id, published, slug, title, full_html, 0 AS ReadMore
-		FROM article
-		WHERE
-			slug = ?
-			AND YEAR(published) = ?
-			AND MONTH(published) = ?
-			AND DAY(published) = ?
-			AND NOT hidden
-	`, slug, year, month, day)
+	articles, _, err := ctx.store.Articles(store.Filter{
+		Slug:  slug,
+		Year:  year,
+		Month: month,
+		Day:   day,
+	})
 
 	if err != nil {
 		return err
 	}
 
 	if len(articles) != 1 {
-		return errNotFound
+		return ctx.redirectToArticle(w, store.Filter{Alias: slug})
 	}
 
-	return ctx.views.RenderArticle(w, ctx.menu, "blog", articles[0])
-}
+	va := viewArticle(articles[0], false)
 
-func (ctx *serveContext) handleArticleQuicklink(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
-	if err != nil {
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		if _, ok := articles[0].Tags[tag]; ok {
+			va.NavTag = tag
+		}
+	}
+
+	if va.Prev, va.Next, err = ctx.adjacentArticles(articles[0], va.NavTag); err != nil {
 		return err
 	}
 
-	vars := mux.Vars(r)
-	slug := vars["slug"]
+	if va.Related, err = ctx.relatedArticles(articles[0]); err != nil {
+		return err
+	}
+
+	if va.ReferencedBy, err = ctx.referencingArticles(articles[0]); err != nil {
+		return err
+	}
+
+	if articles[0].Series != "" {
+		if va.Series, err = ctx.viewSeries(articles[0]); err != nil {
+			return err
+		}
+	}
+
+	return ctx.views.RenderArticle(w, ctx.menu, "blog", va)
+}
+
+// adjacentArticles finds the articles published right before and after an article, optionally limited to a tag
+func (ctx *serveContext) adjacentArticles(a article.Article, tag string) (prev, next *ViewArticleLink, err error) {
+	link := func(filter store.Filter) (*ViewArticleLink, error) {
+		filter.Tag = tag
+		filter.Limit = 1
+
+		articles, _, err := ctx.store.Articles(filter)
+		if err != nil || len(articles) == 0 {
+			return nil, err
+		}
+
+		u := articleUrl(articles[0])
+		if tag != "" {
+			u += "?tag=" + url.QueryEscape(tag)
+		}
+
+		return &ViewArticleLink{Url: u, Title: articles[0].Title}, nil
+	}
+
+	if prev, err = link(store.Filter{PublishedBefore: a.Published, TieSlug: a.Slug}); err != nil {
+		return nil, nil, err
+	}
+
+	next, err = link(store.Filter{PublishedAfter: a.Published, TieSlug: a.Slug, Ascending: true})
+	return prev, next, err
+}
 
-	articles, _, err := viewArticlesFromDb(db, 0, `
-		SELECT article_id, published, slug, title, full_html, 0 AS ReadMore
-		FROM article
-		WHERE
-			slug = ?
-			AND NOT hidden
-	`, slug)
+const numRelatedArticles = 5
 
+func (ctx *serveContext) relatedArticles(a article.Article) ([]ViewArticleLink, error) {
+	articles, err := ctx.store.Related(a.Slug, numRelatedArticles)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(articles) != 1 {
-		return errNotFound
+	links := make([]ViewArticleLink, 0, len(articles))
+	for _, related := range articles {
+		links = append(links, ViewArticleLink{Url: articleUrl(related), Title: related.Title})
 	}
 
-	article := articles[0]
-	y, m, d := article.Published.Date()
+	return links, nil
+}
 
-	w.Header().Set("Location", fmt.Sprintf("/blog/%d/%d/%d/%s", y, m, d, slug))
-	w.WriteHeader(301)
-	return nil
+// untrustedBundleAssetTypes are the file extensions of the assets served from bundles in untrusted paths.
+// Browsers must not be able to run scripts from them, so e.g. HTML and SVG are missing.
+var untrustedBundleAssetTypes = map[string]struct{}{
+	".avif": {},
+	".gif":  {},
+	".jpeg": {},
+	".jpg":  {},
+	".pdf":  {},
+	".png":  {},
+	".txt":  {},
+	".webp": {},
 }
 
-func (ctx *serveContext) handleArchiveDay(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
+// isBundleAsset checks whether a file in the directory of a bundle (given as a slash separated path relative
+// to it) is served. The article source, hidden files and an index.html (which would replace the article
+// in a static export) are not. Bundles in untrusted paths only serve the untrustedBundleAssetTypes.
+func isBundleAsset(rel string, untrusted bool) bool {
+	if rel == "" || rel == article.BundleIndex || rel == "index.html" {
+		return false
+	}
+
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+
+	if untrusted {
+		_, ok := untrustedBundleAssetTypes[strings.ToLower(path.Ext(rel))]
+		return ok
+	}
+
+	return true
+}
+
+// bundleAssetFile returns the file of a bundle asset (given as a slash separated path relative to the bundle
+// directory), if it is a regular file in the directory. Symlinks are rejected, also symlinked directories on the way,
+// so a bundle can't expose files from elsewhere. Like copying the bundle in a static export, which doesn't follow them.
+func bundleAssetFile(bundleDir, rel string) (string, bool) {
+	filename := filepath.Join(bundleDir, filepath.FromSlash(rel))
+
+	info, err := os.Lstat(filename)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+
+	resolvedDir, err := filepath.EvalSymlinks(bundleDir)
 	if err != nil {
-		return err
+		return "", false
 	}
 
+	resolved, err := filepath.EvalSymlinks(filename)
+	if err != nil || resolved != filepath.Join(resolvedDir, filepath.FromSlash(rel)) {
+		return "", false
+	}
+
+	return filename, true
+}
+
+func (ctx *serveContext) handleArticleAsset(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	year, _ := strconv.Atoi(vars["year"])
 	month, _ := strconv.Atoi(vars["month"])
 	day, _ := strconv.Atoi(vars["day"])
 
-	articles, _, err := viewArticlesFromDb(db, 1, `
-		SELECT
-			article_id,
-			published,
-			slug,
-			title,
-			IF(summary_html = '', full_html, summary_html),
-			summary_html != '' AS ReadMore
-		FROM article
-		WHERE
-			YEAR(published) = ?
-			AND MONTH(published) = ?
-			AND DAY(published) = ?
-			AND NOT hidden
-		ORDER BY published ASC
-	`, year, month, day)
+	articles, _, err := ctx.store.Articles(store.Filter{
+		Slug:  vars["slug"],
+		Year:  year,
+		Month: month,
+		Day:   day,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(articles) != 1 || articles[0].BundleDir == "" {
+		return errNotFound
+	}
 
+	conf, err := ctx.env.Config()
 	if err != nil {
 		return err
 	}
 
-	return ctx.views.RenderArchiveDay(w, ctx.menu, "archive", year, month, day, articles)
+	rel := path.Clean("/" + vars["file"])[1:]
+	if !isBundleAsset(rel, conf.IsUntrusted(articles[0].BundleDir)) {
+		return errNotFound
+	}
+
+	filename, ok := bundleAssetFile(articles[0].BundleDir, rel)
+	if !ok {
+		return errNotFound
+	}
+
+	// Don't let browsers guess a more dangerous type than the one derived from the extension
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filename)
+	return nil
 }
 
-func countArticlesBy(db *sql.DB, byExpr, whereExpr string, whereArgs ...interface{}) (map[int]int, error) {
-	rows, err := db.Query(`
-		SELECT `+byExpr+`, COUNT(*)
-		FROM article
-		WHERE `+whereExpr+` AND NOT hidden
-		GROUP BY `+byExpr+`
-	`, whereArgs...)
+// referencingArticles returns links to the articles and pages linking to an article
+func (ctx *serveContext) referencingArticles(a article.Article) ([]ViewArticleLink, error) {
+	articles, _, err := ctx.store.Articles(store.Filter{LinksTo: a.Slug})
+	if err != nil {
+		return nil, err
+	}
 
+	links := make([]ViewArticleLink, 0, len(articles))
+	for _, other := range articles {
+		links = append(links, ViewArticleLink{Url: articleUrl(other), Title: other.Title})
+	}
+
+	seen := make(map[string]struct{})
+	for _, name := range append([]string{a.Slug}, a.Aliases...) {
+		for _, page := range ctx.pageLinks[name] {
+			if _, ok := seen[page]; !ok {
+				seen[page] = struct{}{}
+				links = append(links, ViewArticleLink{Url: "/" + page, Title: page})
+			}
+		}
+	}
+
+	return links, nil
+}
+
+// viewSeries builds the table of contents of the series of an article
+func (ctx *serveContext) viewSeries(a article.Article) (*ViewSeries, error) {
+	parts, _, err := ctx.store.Articles(store.Filter{Series: a.Series})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	counts := make(map[int]int)
-	for rows.Next() {
-		var k, v int
-		if err := rows.Scan(&k, &v); err != nil {
-			return nil, err
+	series := &ViewSeries{
+		Name:  a.Series,
+		Parts: make([]ViewSeriesPart, 0, len(parts)),
+	}
+
+	cur := -1
+	for i, part := range parts {
+		if part.Slug == a.Slug {
+			cur = i
 		}
 
-		counts[k] = v
+		series.Parts = append(series.Parts, ViewSeriesPart{
+			Url:     articleUrl(part),
+			Title:   part.Title,
+			Current: part.Slug == a.Slug,
+		})
 	}
 
-	return counts, nil
+	if cur > 0 {
+		series.Prev = &series.Parts[cur-1]
+	}
+	if cur >= 0 && cur < len(series.Parts)-1 {
+		series.Next = &series.Parts[cur+1]
+	}
+
+	return series, nil
 }
 
-func (ctx *serveContext) handleArchiveMonth(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
+func (ctx *serveContext) handleSeries(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	articles, total, err := viewArticlesFromStore(ctx.store, true, store.Filter{Series: name})
 	if err != nil {
 		return err
 	}
 
+	if total == 0 {
+		return errNotFound
+	}
+
+	return ctx.views.RenderSeries(w, ctx.menu, "blog", name, articles)
+}
+
+func articleUrl(a article.Article) string {
+	y, m, d := a.Published.Date()
+	return fmt.Sprintf("/blog/%d/%d/%d/%s", y, m, d, a.Slug)
+}
+
+// redirectToArticle permanently redirects to the article matching the filter
+func (ctx *serveContext) redirectToArticle(w http.ResponseWriter, filter store.Filter) error {
+	articles, _, err := ctx.store.Articles(filter)
+	if err != nil {
+		return err
+	}
+
+	if len(articles) != 1 {
+		return errNotFound
+	}
+
+	w.Header().Set("Location", articleUrl(articles[0]))
+	w.WriteHeader(301)
+	return nil
+}
+
+func (ctx *serveContext) handleArticleQuicklink(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	slug := vars["slug"]
+
+	err := ctx.redirectToArticle(w, store.Filter{Slug: slug})
+	if err == errNotFound {
+		err = ctx.redirectToArticle(w, store.Filter{Alias: slug})
+	}
+
+	return err
+}
+
+func (ctx *serveContext) handleArchiveDay(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	year, _ := strconv.Atoi(vars["year"])
 	month, _ := strconv.Atoi(vars["month"])
+	day, _ := strconv.Atoi(vars["day"])
+
+	articles, _, err := viewArticlesFromStore(ctx.store, true, store.Filter{
+		Year:      year,
+		Month:     month,
+		Day:       day,
+		Ascending: true,
+	})
 
-	counts, err := countArticlesBy(db, "DAY(published)", "YEAR(published) = ? AND MONTH(published) = ?", year, month)
 	if err != nil {
 		return err
 	}
 
-	return ctx.views.RenderArchiveMonth(w, ctx.menu, "archive", year, month, counts)
+	return ctx.views.RenderArchiveDay(w, ctx.menu, "archive", year, month, day, articles)
 }
 
-func (ctx *serveContext) handleArchiveYear(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
+func (ctx *serveContext) handleArchiveMonth(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	year, _ := strconv.Atoi(vars["year"])
+	month, _ := strconv.Atoi(vars["month"])
+
+	counts, err := ctx.store.ArchiveCounts(year, month)
 	if err != nil {
 		return err
 	}
 
+	return ctx.views.RenderArchiveMonth(w, ctx.menu, "archive", year, month, counts)
+}
+
+func (ctx *serveContext) handleArchiveYear(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	year, _ := strconv.Atoi(vars["year"])
 
-	counts, err := countArticlesBy(db, "MONTH(published)", "YEAR(published) = ?", year)
+	counts, err := ctx.store.ArchiveCounts(year, 0)
 	if err != nil {
 		return err
 	}
@@ -512,12 +720,7 @@ func (ctx *serveContext) handleArchiveYear(w http.ResponseWriter, r *http.Reques
 }
 
 func (ctx *serveContext) handleArchive(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
-	if err != nil {
-		return err
-	}
-
-	counts, err := countArticlesBy(db, "YEAR(published)", "1")
+	counts, err := ctx.store.ArchiveCounts(0, 0)
 	if err != nil {
 		return err
 	}
@@ -555,85 +758,33 @@ func calcPages(total int) int {
 }
 
 func (ctx *serveContext) handleTag(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
-	if err != nil {
-		return err
-	}
-
 	vars := mux.Vars(r)
 	tag := vars["tag"]
 
 	page := getPageArgument(r)
 
-	articles, total, err := viewArticlesFromDb(db, 1, `
-		SELECT SQL_CALC_FOUND_ROWS
-			a.article_id,
-			a.published,
-			a.slug,
-			a.title,
-			IF(a.summary_html = '', a.full_html, a.summary_html),
-			a.summary_html != '' AS ReadMore
-		FROM article_tag t
-		INNER JOIN article a
-			ON a.article_id = t.article_id
-		WHERE
-			t.tag = ?
-			AND NOT a.hidden
-		ORDER BY published DESC
-		LIMIT ? OFFSET ?
-	`, tag, articles_per_page, (page-1)*articles_per_page)
+	articles, total, err := viewArticlesFromStore(ctx.store, true, store.Filter{
+		Tag:    tag,
+		Limit:  articles_per_page,
+		Offset: (page - 1) * articles_per_page,
+	})
 
 	if err != nil {
 		return err
 	}
 
-	pages := calcPages(total)
-	return ctx.views.RenderTag(w, ctx.menu, "tags", tag, articles, pages, page)
-}
-
-func countTags(db *sql.DB) (map[string]int, error) {
-	rows, err := db.Query(`
-		SELECT
-			at.tag,
-			COUNT(*)
-		FROM article_tag at
-		INNER JOIN article a
-			ON a.article_id = at.article_id
-		WHERE NOT a.hidden
-		GROUP BY at.tag
-	`)
-
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	counts := make(map[string]int)
-	for rows.Next() {
-		var k string
-		var v int
-
-		if err := rows.Scan(&k, &v); err != nil {
-			return nil, err
+	if ctx.views.TagNavigation() {
+		for i := range articles {
+			articles[i].NavTag = tag
 		}
-
-		counts[k] = v
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return counts, nil
+	pages := calcPages(total)
+	return ctx.views.RenderTag(w, ctx.menu, "tags", tag, articles, pages, page)
 }
 
 func (ctx *serveContext) handleTags(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
-	if err != nil {
-		return err
-	}
-
-	counts, err := countTags(db)
+	counts, err := ctx.store.TagCounts()
 	if err != nil {
 		return err
 	}
@@ -657,11 +808,6 @@ func getSearchQueryArgument(r *http.Request) string {
 }
 
 func (ctx *serveContext) handleSearch(w http.ResponseWriter, r *http.Request) error {
-	db, err := ctx.env.DB()
-	if err != nil {
-		return err
-	}
-
 	q := getSearchQueryArgument(r)
 	page := getPageArgument(r)
 
@@ -669,21 +815,12 @@ func (ctx *serveContext) handleSearch(w http.ResponseWriter, r *http.Request) er
 	total := 0
 
 	if q != "" {
-		articles, total, err = viewArticlesFromDb(db, 1, `
-			SELECT SQL_CALC_FOUND_ROWS
-				article_id,
-				published,
-				slug,
-				title,
-				IF(summary_html = '', full_html, summary_html),
-				summary_html != '' AS ReadMore
-			FROM article
-			WHERE
-				(MATCH(full_plain) AGAINST(?) OR MATCH(title) AGAINST (?))
-				AND NOT hidden
-			ORDER BY published DESC
-			LIMIT ? OFFSET ?
-		`, q, q, articles_per_page, (page-1)*articles_per_page)
+		var err error
+		articles, total, err = viewArticlesFromStore(ctx.store, true, store.Filter{
+			Search: q,
+			Limit:  articles_per_page,
+			Offset: (page - 1) * articles_per_page,
+		})
 
 		if err != nil {
 			return err
@@ -703,24 +840,10 @@ func (ctx *serveContext) handleSearch(w http.ResponseWriter, r *http.Request) er
 }
 
 func (ctx *serveContext) getBlogData(limit, offset int) ([]ViewArticle, int, error) {
-	db, err := ctx.env.DB()
-	if err != nil {
-		return nil, 0, err
-	}
-
-	return viewArticlesFromDb(db, 1, `
-		SELECT SQL_CALC_FOUND_ROWS
-			article_id,
-			published,
-			slug,
-			title,
-			IF(summary_html = '', full_html, summary_html),
-			summary_html != '' AS ReadMore
-		FROM article
-		WHERE NOT hidden
-		ORDER BY published DESC
-		LIMIT ? OFFSET ?
-	`, limit, offset)
+	return viewArticlesFromStore(ctx.store, true, store.Filter{
+		Limit:  limit,
+		Offset: offset,
+	})
 }
 
 const numFeedEntries = 30
@@ -732,17 +855,29 @@ func (ctx *serveContext) handleFeed(w http.ResponseWriter, r *http.Request) erro
 		return err
 	}
 
+	var feedUpdated time.Time
 	entries := make([]atom.Entry, 0, len(articles))
 	for _, article := range articles {
+		if article.Updated.After(feedUpdated) {
+			feedUpdated = article.Updated
+		}
+
 		y, m, d := article.Published.Date()
 		url := fmt.Sprintf("http://laria.me/blog/%d/%d/%d/%s", y, m, d, article.Slug)
+
+		content := string(article.Content)
+		if article.WordCount > 0 {
+			// Atom has no element for this, so it becomes part of the summary, like in the article meta block
+			content = fmt.Sprintf("<p>%d words, %d min read</p>", article.WordCount, article.ReadingMinutes) + content
+		}
+
 		entries = append(entries, atom.Entry{
 			Title:   article.Title,
 			Id:      url,
-			Updated: article.Published, // TODO: Or should modification time be tracked?
+			Updated: article.Updated,
 			Summary: atom.Summary{
 				Type:    "html",
-				Content: string(article.Content),
+				Content: content,
 			},
 			Links: []atom.Link{
 				atom.Link{Rel: "alternate", Href: url},
@@ -750,6 +885,11 @@ func (ctx *serveContext) handleFeed(w http.ResponseWriter, r *http.Request) erro
 		})
 	}
 
+	if feedUpdated.IsZero() {
+		// Without any articles there is nothing the feed could have been updated with, but it needs a valid time
+		feedUpdated = time.Now()
+	}
+
 	feed := atom.Feed{
 		Title: "laria.me Blog",
 		Links: []atom.Link{
@@ -760,7 +900,7 @@ func (ctx *serveContext) handleFeed(w http.ResponseWriter, r *http.Request) erro
 		AuthorName:  "Laria Carolin Chabowski",
 		AuthorEmail: "laria-blog@laria.me",
 		AuthorUri:   "http://laria.me",
-		Updated:     articles[0].Published, // TODO: This should be able to deal with articles being empty
+		Updated:     feedUpdated,
 		Entries:     entries,
 	}
 
@@ -804,39 +944,65 @@ func (ctx *serveContext) handleHome(w http.ResponseWriter, r *http.Request) erro
 	return ctx.views.RenderStart(w, ctx.menu, "", ctx.pages["hello"], articles)
 }
 
-func cmdServe(progname string, env *environment.Env, args []string) {
-	config, err := env.Config()
-	if err != nil {
-		log.Fatalf("Could not load config: %s", err)
-	}
+func (ctx *serveContext) handleSyntaxCss(w http.ResponseWriter, r *http.Request) {
+	ctx.rwMutex.RLock()
+	defer ctx.rwMutex.RUnlock()
 
-	ctx, err := newServeContext(env)
-	if err != nil {
-		log.Fatalf("Could not create serveContext: %s", err)
-	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Write(ctx.syntaxCss)
+}
 
+func (ctx *serveContext) router(staticPath string) *mux.Router {
 	r := mux.NewRouter()
 
-	if config.StaticPath != "" {
-		r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(config.StaticPath))))
+	// Takes precedence over a syntax.css in staticPath
+	if ctx.syntaxCss != nil {
+		r.HandleFunc("/static/syntax.css", ctx.handleSyntaxCss)
+	}
+
+	if staticPath != "" {
+		r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(staticPath))))
 	}
 
 	r.HandleFunc("/__update", ctx.handleUpdate)
 	r.HandleFunc("/blog/q/{slug}", wrapHandleFunc("article-quicklink", ctx.handleArticleQuicklink))
 	r.HandleFunc("/blog/{year:[0-9]+}/{month:[0-9]+}/{day:[0-9]+}/{slug}", wrapHandleFunc("article", ctx.handleArticle))
+	r.HandleFunc("/blog/{year:[0-9]+}/{month:[0-9]+}/{day:[0-9]+}/{slug}/{file:.+}", wrapHandleFunc("article-asset", ctx.handleArticleAsset))
 	r.HandleFunc("/blog/{year:[0-9]+}/{month:[0-9]+}/{day:[0-9]+}", wrapHandleFunc("archiveDay", ctx.handleArchiveDay))
 	r.HandleFunc("/blog/{year:[0-9]+}/{month:[0-9]+}", wrapHandleFunc("archiveMonth", ctx.handleArchiveMonth))
 	r.HandleFunc("/blog/{year:[0-9]+}", wrapHandleFunc("archiveYear", ctx.handleArchiveYear))
 	r.HandleFunc("/blog/archive", wrapHandleFunc("archive", ctx.handleArchive))
 	r.HandleFunc("/blog/tags/{tag}", wrapHandleFunc("tag", ctx.handleTag))
 	r.HandleFunc("/blog/tags", wrapHandleFunc("tags", ctx.handleTags))
+	r.HandleFunc("/blog/series/{name}", wrapHandleFunc("series", ctx.handleSeries))
 	r.HandleFunc("/blog/search", wrapHandleFunc("search", ctx.handleSearch))
 	r.HandleFunc("/blog/feed.xml", wrapHandleFunc("feed", ctx.handleFeed))
 	r.HandleFunc("/blog", wrapHandleFunc("blog", ctx.handleBlog))
 	r.HandleFunc("/{page}", wrapHandleFunc("page", ctx.handlePage))
 	r.HandleFunc("/", wrapHandleFunc("home", ctx.handleHome))
 
-	if err := http.ListenAndServe(config.HttpLaddr, r); err != nil {
+	return r
+}
+
+func cmdServe(progname string, env *environment.Env, args []string) {
+	config, err := env.Config()
+	if err != nil {
+		log.Fatalf("Could not load config: %s", err)
+	}
+
+	requireCurrentSchema(progname, env)
+
+	st, err := env.Store()
+	if err != nil {
+		log.Fatalf("Could not open store: %s", err)
+	}
+
+	ctx, err := newServeContext(env, st)
+	if err != nil {
+		log.Fatalf("Could not create serveContext: %s", err)
+	}
+
+	if err := http.ListenAndServe(config.HttpLaddr, ctx.router(config.StaticPath)); err != nil {
 		log.Fatalln(err)
 	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsBundleAsset(t *testing.T) {
+	tests := []struct {
+		rel       string
+		untrusted bool
+		want      bool
+	}{
+		{"img/diagram.png", false, true},
+		{"notes.txt", false, true},
+		{"demo.html", false, true},
+		{"index.md", false, false},
+		{"index.html", false, false},
+		{"img/index.html", false, true},
+		{".secret", false, false},
+		{"img/.hidden/a.png", false, false},
+		{"", false, false},
+		{"img/diagram.PNG", true, true},
+		{"paper.pdf", true, true},
+		{"demo.html", true, false},
+		{"drawing.svg", true, false},
+		{"noextension", true, false},
+	}
+
+	for _, test := range tests {
+		if got := isBundleAsset(test.rel, test.untrusted); got != test.want {
+			t.Errorf("isBundleAsset(%q, %t) = %t, want %t", test.rel, test.untrusted, got, test.want)
+		}
+	}
+}
+
+func TestBundleAssetFile(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "bundle")
+	outside := filepath.Join(root, "outside")
+
+	for _, d := range []string{filepath.Join(dir, "img"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, filename := range []string{filepath.Join(dir, "img", "a.png"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(filename, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		filepath.Join(dir, "leak.txt"): filepath.Join(outside, "secret.txt"),
+		filepath.Join(dir, "linked"):   outside,
+		filepath.Join(dir, "same.png"): filepath.Join(dir, "img", "a.png"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks not supported: %s", err)
+		}
+	}
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"img/a.png", true},
+		{"img", false},
+		{"missing.png", false},
+		{"leak.txt", false},
+		{"linked/secret.txt", false},
+		{"same.png", false},
+	}
+
+	for _, test := range tests {
+		filename, ok := bundleAssetFile(dir, test.rel)
+		if ok != test.want {
+			t.Errorf("bundleAssetFile(%q): got %t, want %t", test.rel, ok, test.want)
+		}
+		if ok && filename != filepath.Join(dir, filepath.FromSlash(test.rel)) {
+			t.Errorf("bundleAssetFile(%q): got file %q", test.rel, filename)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.laria.me/laria.me/article"
+)
+
+// Memory is a Store keeping all articles in memory, without any database
+type Memory struct {
+	mu            sync.RWMutex
+	articles      map[string]article.Article
+	includeDrafts bool
+}
+
+// NewMemory creates an empty Memory store. If includeDrafts is set, hidden and future articles
+// will be treated like visible ones.
+func NewMemory(includeDrafts bool) *Memory {
+	return &Memory{
+		articles:      make(map[string]article.Article),
+		includeDrafts: includeDrafts,
+	}
+}
+
+func (m *Memory) saveArticle(a article.Article) {
+	stored, ok := m.articles[a.Slug]
+	if ok {
+		a.Updated = a.UpdatedTime(stored.ContentHash, stored.Updated)
+	} else {
+		a.Updated = a.UpdatedTime("", time.Time{})
+	}
+
+	m.articles[a.Slug] = a
+}
+
+func (m *Memory) SaveArticle(a article.Article) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.saveArticle(a)
+	return nil
+}
+
+func (m *Memory) DeleteArticlesExcept(slugs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(slugs) == 0 {
+		return nil
+	}
+
+	keep := make(map[string]struct{})
+	for _, slug := range slugs {
+		keep[slug] = struct{}{}
+	}
+
+	for slug := range m.articles {
+		if _, ok := keep[slug]; !ok {
+			delete(m.articles, slug)
+		}
+	}
+
+	return nil
+}
+
+// Replace replaces all articles of the store at once
+func (m *Memory) Replace(articles []article.Article) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.articles
+	m.articles = make(map[string]article.Article)
+	for _, a := range articles {
+		if stored, ok := old[a.Slug]; ok {
+			m.articles[a.Slug] = stored
+		}
+		m.saveArticle(a)
+	}
+}
+
+func (m *Memory) visible(a article.Article, now time.Time) bool {
+	return m.includeDrafts || a.IsPublic(now)
+}
+
+func hasAlias(a article.Article, alias string) bool {
+	for _, other := range a.Aliases {
+		if other == alias {
+			return true
+		}
+	}
+	return false
+}
+
+func linksTo(a article.Article, slug string) bool {
+	for _, link := range a.Links {
+		if link == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filter) matches(a article.Article) bool {
+	if f.Slug != "" && a.Slug != f.Slug {
+		return false
+	}
+
+	if f.Series != "" && a.Series != f.Series {
+		return false
+	}
+
+	if f.Alias != "" && !hasAlias(a, f.Alias) {
+		return false
+	}
+
+	if f.LinksTo != "" && !linksTo(a, f.LinksTo) {
+		return false
+	}
+
+	if f.Tag != "" {
+		if _, ok := a.Tags[f.Tag]; !ok {
+			return false
+		}
+	}
+
+	if !f.PublishedBefore.IsZero() && !a.Published.Before(f.PublishedBefore) &&
+		!(f.TieSlug != "" && a.Published.Equal(f.PublishedBefore) && a.Slug < f.TieSlug) {
+		return false
+	}
+
+	if !f.PublishedAfter.IsZero() && !a.Published.After(f.PublishedAfter) &&
+		!(f.TieSlug != "" && a.Published.Equal(f.PublishedAfter) && a.Slug > f.TieSlug) {
+		return false
+	}
+
+	y, mon, d := a.Published.Date()
+	if (f.Year != 0 && f.Year != y) || (f.Month != 0 && f.Month != int(mon)) || (f.Day != 0 && f.Day != d) {
+		return false
+	}
+
+	if f.Search != "" {
+		q := strings.ToLower(f.Search)
+		if !strings.Contains(strings.ToLower(a.Title), q) && !strings.Contains(strings.ToLower(a.FullPlain), q) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortedArticles returns all articles for which the predicate returns true, ordered by publishing date
+func (m *Memory) sortedArticles(ascending bool, pred func(a article.Article) bool) []article.Article {
+	articles := make([]article.Article, 0)
+	for _, a := range m.articles {
+		if pred(a) {
+			articles = append(articles, a)
+		}
+	}
+
+	sort.Slice(articles, func(i, j int) bool {
+		a, b := articles[i], articles[j]
+		if !a.Published.Equal(b.Published) {
+			return a.Published.Before(b.Published) == ascending
+		}
+		return (a.Slug < b.Slug) == ascending
+	})
+
+	return articles
+}
+
+func (m *Memory) Articles(f Filter) ([]article.Article, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := article.WallClock(time.Now())
+	articles := m.sortedArticles(f.Ascending || f.Series != "", func(a article.Article) bool {
+		return m.visible(a, now) && f.matches(a)
+	})
+
+	if f.Series != "" {
+		sort.SliceStable(articles, func(i, j int) bool {
+			return articles[i].SeriesOrder < articles[j].SeriesOrder
+		})
+	}
+
+	total := len(articles)
+
+	if f.Offset >= len(articles) {
+		articles = articles[:0]
+	} else {
+		articles = articles[f.Offset:]
+	}
+
+	if f.Limit > 0 && f.Limit < len(articles) {
+		articles = articles[:f.Limit]
+	}
+
+	return articles, total, nil
+}
+
+func (m *Memory) Related(slug string, limit int) ([]article.Article, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := article.WallClock(time.Now())
+	articles := make([]article.Article, 0, limit)
+	for _, relatedSlug := range m.articles[slug].Related {
+		if len(articles) >= limit {
+			break
+		}
+
+		if a, ok := m.articles[relatedSlug]; ok && m.visible(a, now) {
+			articles = append(articles, a)
+		}
+	}
+
+	return articles, nil
+}
+
+func (m *Memory) ArchiveCounts(year, month int) (map[int]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := article.WallClock(time.Now())
+	counts := make(map[int]int)
+	for _, a := range m.articles {
+		if !m.visible(a, now) {
+			continue
+		}
+
+		y, mon, d := a.Published.Date()
+		switch {
+		case year == 0:
+			counts[y]++
+		case y != year:
+		case month == 0:
+			counts[int(mon)]++
+		case int(mon) == month:
+			counts[d]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (m *Memory) TagCounts() (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := article.WallClock(time.Now())
+	counts := make(map[string]int)
+	for _, a := range m.articles {
+		if !m.visible(a, now) {
+			continue
+		}
+
+		for tag := range a.Tags {
+			counts[tag]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (m *Memory) Scheduled() ([]article.Article, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := article.WallClock(time.Now())
+	return m.sortedArticles(true, func(a article.Article) bool {
+		return a.Published.After(now)
+	}), nil
+}
+
+// Migrations always returns an empty list, there is no schema to migrate
+func (m *Memory) Migrations() ([]Migration, error) { return []Migration{}, nil }
+
+func (m *Memory) Migrate() ([]Migration, error) { return []Migration{}, nil }
+
+func (m *Memory) Close() error { return nil }
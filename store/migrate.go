@@ -0,0 +1,217 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.laria.me/laria.me/dbutils"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migration is a numbered schema migration
+type Migration struct {
+	Version int
+	Name    string
+	Applied bool
+
+	sql string
+}
+
+var reMigrationFilename = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+// availableMigrations returns the embedded migrations for a dialect, ordered by version
+func availableMigrations(d dialect) ([]Migration, error) {
+	dir := path.Join("migrations", d.driverName())
+
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		m := reMigrationFilename.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(migrationsFS, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    m[2],
+			sql:     string(content),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+var reStatementEnd = regexp.MustCompile(`;\s*(?:\n|$)`)
+
+// splitStatements splits a migration into single statements, not every driver can execute multiple at once.
+// Statements are terminated by a semicolon at the end of a line.
+func splitStatements(s string) []string {
+	statements := make([]string, 0)
+	for _, stmt := range reStatementEnd.Split(s, -1) {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
+
+func (s *sqlStore) createVersionTable() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INT NOT NULL PRIMARY KEY,
+			applied DATETIME NOT NULL
+		)
+	`)
+	return err
+}
+
+// appliedVersions reads the applied migrations without modifying the database,
+// nothing is applied yet if the version table doesn't exist
+func (s *sqlStore) appliedVersions() (map[int]struct{}, error) {
+	versions := make(map[int]struct{})
+
+	var tables int
+	if err := s.db.QueryRow(s.dialect.tableExists(), "schema_version").Scan(&tables); err != nil {
+		return nil, err
+	}
+	if tables == 0 {
+		return versions, nil
+	}
+
+	rows, err := s.db.Query(`SELECT version FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		versions[version] = struct{}{}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (s *sqlStore) Migrations() ([]Migration, error) {
+	migrations, err := availableMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range migrations {
+		_, migrations[i].Applied = applied[m.Version]
+	}
+
+	return migrations, nil
+}
+
+func applyMigration(tx *sql.Tx, m Migration) error {
+	for _, stmt := range splitStatements(m.sql) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO schema_version (version, applied) VALUES (?, ?)`,
+		m.Version,
+		time.Now().Format(dbDateFormat),
+	)
+	return err
+}
+
+func (s *sqlStore) Migrate() ([]Migration, error) {
+	if err := s.createVersionTable(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0)
+	for _, m := range migrations {
+		if m.Applied {
+			continue
+		}
+
+		// Note that MySQL implicitly commits DDL statements, so a failing migration might be applied partially there
+		tx, err := s.db.Begin()
+		if err != nil {
+			return applied, err
+		}
+
+		err = applyMigration(tx, m)
+		if err = dbutils.TxCommitIfOk(tx, err); err != nil {
+			return applied, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+
+		m.Applied = true
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// PendingMigrations returns the migrations not yet applied to the store
+func PendingMigrations(s Store) ([]Migration, error) {
+	migrations, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]Migration, 0)
+	for _, m := range migrations {
+		if !m.Applied {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
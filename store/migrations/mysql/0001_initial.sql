@@ -1,4 +1,4 @@
-CREATE TABLE article (
+CREATE TABLE IF NOT EXISTS article (
     article_id INT UNSIGNED NOT NULL PRIMARY KEY AUTO_INCREMENT,
     slug VARCHAR(200) NOT NULL UNIQUE,
     published DATETIME NOT NULL,
@@ -8,17 +8,15 @@ CREATE TABLE article (
     full_html LONGTEXT NOT NULL,
     full_plain LONGTEXT NOT NULL,
     FULLTEXT(full_plain),
-    FULLTEXT(title)
+    FULLTEXT(title),
+    INDEX by_slug (slug),
+    INDEX by_publish_date (published)
 );
 
-CREATE INDEX by_slug ON article (slug);
-CREATE INDEX by_publish_date ON article (published);
-
-CREATE TABLE article_tag (
+CREATE TABLE IF NOT EXISTS article_tag (
     article_id INT UNSIGNED NOT NULL REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE,
     tag VARCHAR(200) NOT NULL,
     PRIMARY KEY(article_id, tag),
-    CONSTRAINT article_fk FOREIGN KEY (article_id) REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE
+    CONSTRAINT article_fk FOREIGN KEY (article_id) REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE,
+    INDEX by_tag (tag)
 );
-
-CREATE INDEX by_tag ON article_tag (tag);
@@ -0,0 +1,10 @@
+ALTER TABLE article
+    ADD COLUMN updated DATETIME NULL AFTER published,
+    ADD COLUMN extra LONGTEXT NULL,
+    ADD COLUMN content_hash CHAR(64) NOT NULL DEFAULT '';
+
+UPDATE article SET updated = published, extra = '{}';
+
+ALTER TABLE article
+    MODIFY updated DATETIME NOT NULL,
+    MODIFY extra LONGTEXT NOT NULL;
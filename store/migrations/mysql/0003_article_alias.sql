@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS article_alias (
+    alias VARCHAR(200) NOT NULL PRIMARY KEY,
+    article_id INT UNSIGNED NOT NULL,
+    CONSTRAINT article_alias_fk FOREIGN KEY (article_id) REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE
+);
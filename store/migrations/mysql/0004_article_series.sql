@@ -0,0 +1,4 @@
+ALTER TABLE article
+    ADD COLUMN series VARCHAR(200) NOT NULL DEFAULT '',
+    ADD COLUMN series_order INT NOT NULL DEFAULT 0,
+    ADD INDEX by_series (series);
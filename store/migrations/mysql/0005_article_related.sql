@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS article_related (
+    article_id INT UNSIGNED NOT NULL,
+    position INT UNSIGNED NOT NULL,
+    related_slug VARCHAR(200) NOT NULL,
+    PRIMARY KEY(article_id, position),
+    CONSTRAINT article_related_fk FOREIGN KEY (article_id) REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE
+);
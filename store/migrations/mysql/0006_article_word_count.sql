@@ -0,0 +1,3 @@
+ALTER TABLE article
+    ADD COLUMN word_count INT UNSIGNED NOT NULL DEFAULT 0,
+    ADD COLUMN reading_time INT UNSIGNED NOT NULL DEFAULT 0;
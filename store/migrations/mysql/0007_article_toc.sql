@@ -0,0 +1,5 @@
+ALTER TABLE article ADD COLUMN toc LONGTEXT NULL;
+
+UPDATE article SET toc = '[]';
+
+ALTER TABLE article MODIFY toc LONGTEXT NOT NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE article ADD COLUMN list_html LONGTEXT NULL;
+
+-- Until the next update, without shifted headings
+UPDATE article SET list_html = CASE WHEN summary_html != '' THEN summary_html ELSE full_html END;
+
+ALTER TABLE article MODIFY list_html LONGTEXT NOT NULL;
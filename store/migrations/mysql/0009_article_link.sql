@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS article_link (
+    article_id INT UNSIGNED NOT NULL,
+    target_slug VARCHAR(200) NOT NULL,
+    PRIMARY KEY(article_id, target_slug),
+    KEY article_link_target (target_slug),
+    CONSTRAINT article_link_fk FOREIGN KEY (article_id) REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+ALTER TABLE article ADD COLUMN bundle_dir TEXT NULL;
+
+UPDATE article SET bundle_dir = '';
+
+ALTER TABLE article MODIFY bundle_dir TEXT NOT NULL;
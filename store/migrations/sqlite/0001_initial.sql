@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS article (
+    article_id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    published DATETIME NOT NULL,
+    hidden INTEGER NOT NULL DEFAULT 0,
+    title TEXT NOT NULL,
+    summary_html TEXT NOT NULL,
+    full_html TEXT NOT NULL,
+    full_plain TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS by_publish_date ON article (published);
+
+CREATE TABLE IF NOT EXISTS article_tag (
+    article_id INTEGER NOT NULL REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY(article_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS by_tag ON article_tag (tag);
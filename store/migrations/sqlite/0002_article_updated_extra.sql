@@ -0,0 +1,5 @@
+ALTER TABLE article ADD COLUMN updated DATETIME NOT NULL DEFAULT '';
+ALTER TABLE article ADD COLUMN extra TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE article ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+
+UPDATE article SET updated = published;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS article_alias (
+    alias TEXT NOT NULL PRIMARY KEY,
+    article_id INTEGER NOT NULL REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS alias_by_article ON article_alias (article_id);
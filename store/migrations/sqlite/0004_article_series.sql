@@ -0,0 +1,4 @@
+ALTER TABLE article ADD COLUMN series TEXT NOT NULL DEFAULT '';
+ALTER TABLE article ADD COLUMN series_order INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS by_series ON article (series);
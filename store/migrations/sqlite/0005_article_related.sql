@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS article_related (
+    article_id INTEGER NOT NULL REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    related_slug TEXT NOT NULL,
+    PRIMARY KEY(article_id, position)
+);
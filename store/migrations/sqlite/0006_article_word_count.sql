@@ -0,0 +1,2 @@
+ALTER TABLE article ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE article ADD COLUMN reading_time INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE article ADD COLUMN toc TEXT NOT NULL DEFAULT '[]';
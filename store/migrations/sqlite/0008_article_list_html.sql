@@ -0,0 +1,4 @@
+ALTER TABLE article ADD COLUMN list_html TEXT NOT NULL DEFAULT '';
+
+-- Until the next update, without shifted headings
+UPDATE article SET list_html = CASE WHEN summary_html != '' THEN summary_html ELSE full_html END;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS article_link (
+    article_id INTEGER NOT NULL REFERENCES article (article_id) ON UPDATE CASCADE ON DELETE CASCADE,
+    target_slug TEXT NOT NULL,
+    PRIMARY KEY(article_id, target_slug)
+);
+
+CREATE INDEX IF NOT EXISTS article_link_target ON article_link (target_slug);
@@ -0,0 +1 @@
+ALTER TABLE article ADD COLUMN bundle_dir TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) driverName() string { return "mysql" }
+
+func (mysqlDialect) datePart(part, expr string) string {
+	return strings.ToUpper(part) + "(" + expr + ")"
+}
+
+func (mysqlDialect) tableExists() string {
+	return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`
+}
+
+func (mysqlDialect) searchCondition(q string) (string, []interface{}) {
+	return "(MATCH(a.full_plain) AGAINST(?) OR MATCH(a.title) AGAINST (?))", []interface{}{q, q}
+}
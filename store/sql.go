@@ -0,0 +1,704 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"code.laria.me/laria.me/article"
+	"code.laria.me/laria.me/dbutils"
+)
+
+// dialect abstracts the differences between the SQL databases supported by sqlStore
+type dialect interface {
+	driverName() string
+	// datePart returns an integer expression extracting a part ("year", "month" or "day") of a datetime expression
+	datePart(part, expr string) string
+	// searchCondition returns a condition for a full text search on the article table aliased as a
+	searchCondition(q string) (string, []interface{})
+	// tableExists returns a query counting the tables with the name given as its only argument
+	tableExists() string
+}
+
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func extraJson(a article.Article) (string, error) {
+	if len(a.Extra) == 0 {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(a.Extra)
+	return string(b), err
+}
+
+func tocJson(a article.Article) (string, error) {
+	if len(a.Toc) == 0 {
+		return "[]", nil
+	}
+
+	b, err := json.Marshal(a.Toc)
+	return string(b), err
+}
+
+func updateArticleDetails(tx *sql.Tx, a article.Article, id int64, updated time.Time) error {
+	extra, err := extraJson(a)
+	if err != nil {
+		return err
+	}
+
+	toc, err := tocJson(a)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE article SET
+			published = ?,
+			updated = ?,
+			hidden = ?,
+			title = ?,
+			summary_html = ?,
+			full_html = ?,
+			full_plain = ?,
+			list_html = ?,
+			extra = ?,
+			content_hash = ?,
+			series = ?,
+			series_order = ?,
+			word_count = ?,
+			reading_time = ?,
+			toc = ?,
+			bundle_dir = ?
+		WHERE article_id = ?
+	`, a.Published.Format(dbDateFormat), updated.Format(dbDateFormat), a.Hidden, a.Title, a.SummaryHtml, a.FullHtml, a.FullPlain, a.ListHtml, extra, a.ContentHash, a.Series, a.SeriesOrder, a.WordCount, int(a.ReadingTime.Seconds()), toc, a.BundleDir, id)
+
+	return err
+}
+
+func createArticle(tx *sql.Tx, a article.Article, updated time.Time) (int64, error) {
+	extra, err := extraJson(a)
+	if err != nil {
+		return 0, err
+	}
+
+	toc, err := tocJson(a)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO article
+			(slug, published, updated, hidden, title, summary_html, full_html, full_plain, list_html, extra, content_hash, series, series_order, word_count, reading_time, toc, bundle_dir)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.Slug, a.Published.Format(dbDateFormat), updated.Format(dbDateFormat), a.Hidden, a.Title, a.SummaryHtml, a.FullHtml, a.FullPlain, a.ListHtml, extra, a.ContentHash, a.Series, a.SeriesOrder, a.WordCount, int(a.ReadingTime.Seconds()), toc, a.BundleDir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+func setTags(tx *sql.Tx, id int64, tags map[string]struct{}) error {
+	if _, err := tx.Exec(`DELETE FROM article_tag WHERE article_id = ?`, id); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO article_tag (article_id, tag) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for tag := range tags {
+		if _, err = stmt.Exec(id, tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setAliases(tx *sql.Tx, id int64, aliases []string) error {
+	if _, err := tx.Exec(`DELETE FROM article_alias WHERE article_id = ?`, id); err != nil {
+		return err
+	}
+
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	// An alias might have moved from another article
+	inSql, inArgs := buildInStringsSqlAndArgs("alias", aliases)
+	if _, err := tx.Exec(`DELETE FROM article_alias WHERE `+inSql, inArgs...); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO article_alias (alias, article_id) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, alias := range aliases {
+		if _, err = stmt.Exec(alias, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setRelated(tx *sql.Tx, id int64, related []string) error {
+	if _, err := tx.Exec(`DELETE FROM article_related WHERE article_id = ?`, id); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO article_related (article_id, position, related_slug) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, slug := range related {
+		if _, err = stmt.Exec(id, i, slug); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setLinks(tx *sql.Tx, id int64, links []string) error {
+	if _, err := tx.Exec(`DELETE FROM article_link WHERE article_id = ?`, id); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO article_link (article_id, target_slug) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, slug := range links {
+		if _, err = stmt.Exec(id, slug); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func saveArticle(tx *sql.Tx, a article.Article) error {
+	var id int64
+	var storedHash string
+	var storedUpdated nullTime
+
+	switch err := tx.QueryRow(
+		`SELECT article_id, content_hash, updated FROM article WHERE slug = ?`,
+		a.Slug,
+	).Scan(&id, &storedHash, &storedUpdated); err {
+	case nil:
+		if err = updateArticleDetails(tx, a, id, a.UpdatedTime(storedHash, storedUpdated.Time)); err != nil {
+			return err
+		}
+	case sql.ErrNoRows:
+		id, err = createArticle(tx, a, a.UpdatedTime("", time.Time{}))
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	if err := setTags(tx, id, a.Tags); err != nil {
+		return err
+	}
+
+	if err := setAliases(tx, id, a.Aliases); err != nil {
+		return err
+	}
+
+	if err := setRelated(tx, id, a.Related); err != nil {
+		return err
+	}
+
+	return setLinks(tx, id, a.Links)
+}
+
+func (s *sqlStore) SaveArticle(a article.Article) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = saveArticle(tx, a)
+	return dbutils.TxCommitIfOk(tx, err)
+}
+
+func buildInStringsSqlAndArgs(field string, strs []string) (string, []interface{}) {
+	args := make([]interface{}, 0, len(strs))
+	for _, s := range strs {
+		args = append(args, interface{}(s))
+	}
+
+	return field + " IN (?" + strings.Repeat(",?", len(strs)-1) + ")", args
+}
+
+func (s *sqlStore) DeleteArticlesExcept(slugs []string) error {
+	if len(slugs) == 0 {
+		return nil
+	}
+
+	inSql, inArgs := buildInStringsSqlAndArgs("slug", slugs)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Not relying on ON DELETE CASCADE here, SQLite only enforces foreign keys if explicitly enabled
+	for _, table := range []string{"article_tag", "article_alias", "article_related", "article_link"} {
+		if _, err = tx.Exec(`
+			DELETE FROM `+table+`
+			WHERE article_id IN (SELECT article_id FROM article WHERE NOT `+inSql+`)
+		`, inArgs...); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM article WHERE NOT `+inSql, inArgs...)
+	}
+
+	return dbutils.TxCommitIfOk(tx, err)
+}
+
+// now returns the current time in the format of the published column. It's computed here instead of in SQL,
+// so that all databases (and the Memory store) agree on the time zone.
+func now() string {
+	return article.WallClock(time.Now()).Format(dbDateFormat)
+}
+
+// visibleCondition is the condition for visible articles in the article table aliased as a
+func visibleCondition() (string, []interface{}) {
+	return "NOT a.hidden AND a.published <= ?", []interface{}{now()}
+}
+
+func (s *sqlStore) filterSql(f Filter) (string, []interface{}) {
+	from := new(strings.Builder)
+	from.WriteString("FROM article a ")
+
+	visible, args := visibleCondition()
+	where := []string{visible}
+
+	if f.Tag != "" {
+		from.WriteString("INNER JOIN article_tag t ON t.article_id = a.article_id ")
+		where = append(where, "t.tag = ?")
+		args = append(args, f.Tag)
+	}
+
+	if f.Slug != "" {
+		where = append(where, "a.slug = ?")
+		args = append(args, f.Slug)
+	}
+
+	if f.Series != "" {
+		where = append(where, "a.series = ?")
+		args = append(args, f.Series)
+	}
+
+	if f.Alias != "" {
+		where = append(where, "a.article_id IN (SELECT article_id FROM article_alias WHERE alias = ?)")
+		args = append(args, f.Alias)
+	}
+
+	if f.LinksTo != "" {
+		from.WriteString("INNER JOIN article_link l ON l.article_id = a.article_id ")
+		where = append(where, "l.target_slug = ?")
+		args = append(args, f.LinksTo)
+	}
+
+	if !f.PublishedBefore.IsZero() {
+		published := f.PublishedBefore.Format(dbDateFormat)
+		if f.TieSlug != "" {
+			where = append(where, "(a.published < ? OR (a.published = ? AND a.slug < ?))")
+			args = append(args, published, published, f.TieSlug)
+		} else {
+			where = append(where, "a.published < ?")
+			args = append(args, published)
+		}
+	}
+
+	if !f.PublishedAfter.IsZero() {
+		published := f.PublishedAfter.Format(dbDateFormat)
+		if f.TieSlug != "" {
+			where = append(where, "(a.published > ? OR (a.published = ? AND a.slug > ?))")
+			args = append(args, published, published, f.TieSlug)
+		} else {
+			where = append(where, "a.published > ?")
+			args = append(args, published)
+		}
+	}
+
+	for _, part := range []struct {
+		name  string
+		value int
+	}{
+		{"year", f.Year},
+		{"month", f.Month},
+		{"day", f.Day},
+	} {
+		if part.value != 0 {
+			where = append(where, s.dialect.datePart(part.name, "a.published")+" = ?")
+			args = append(args, part.value)
+		}
+	}
+
+	if f.Search != "" {
+		cond, condArgs := s.dialect.searchCondition(f.Search)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	return from.String() + "WHERE " + strings.Join(where, " AND "), args
+}
+
+// articlesFromRows reads articles from a query selecting the columns
+// article_id, slug, published, updated, hidden, title, summary_html, full_html, list_html, extra, series, series_order,
+// word_count, reading_time, toc, bundle_dir
+func articlesFromRows(tx *sql.Tx, rows *sql.Rows) ([]article.Article, error) {
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	articlesById := make(map[int]*article.Article)
+	for rows.Next() {
+		var a article.Article
+		var id int
+		var published, updated nullTime
+		var extra, toc string
+		var readingTime int
+
+		if err := rows.Scan(
+			&id,
+			&a.Slug,
+			&published,
+			&updated,
+			&a.Hidden,
+			&a.Title,
+			&a.SummaryHtml,
+			&a.FullHtml,
+			&a.ListHtml,
+			&extra,
+			&a.Series,
+			&a.SeriesOrder,
+			&a.WordCount,
+			&readingTime,
+			&toc,
+			&a.BundleDir,
+		); err != nil {
+			return nil, err
+		}
+
+		a.Published = published.Time
+		a.Updated = updated.Time
+		a.ReadingTime = time.Duration(readingTime) * time.Second
+		a.Tags = make(map[string]struct{})
+
+		if err := json.Unmarshal([]byte(extra), &a.Extra); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(toc), &a.Toc); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+		articlesById[id] = &a
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) > 0 {
+		inSql, inArgs := dbutils.BuildInIdsSqlAndArgs("article_id", ids)
+
+		rows, err := tx.Query(`
+			SELECT article_id, tag
+			FROM article_tag
+			WHERE `+inSql+`
+		`, inArgs...)
+
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int
+			var tag string
+
+			if err := rows.Scan(&id, &tag); err != nil {
+				return nil, err
+			}
+
+			if a, ok := articlesById[id]; ok {
+				a.Tags[tag] = struct{}{}
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := loadAliases(tx, ids, articlesById); err != nil {
+			return nil, err
+		}
+	}
+
+	articles := make([]article.Article, 0, len(ids))
+	for _, id := range ids {
+		articles = append(articles, *articlesById[id])
+	}
+
+	return articles, nil
+}
+
+func loadAliases(tx *sql.Tx, ids []int, articlesById map[int]*article.Article) error {
+	inSql, inArgs := dbutils.BuildInIdsSqlAndArgs("article_id", ids)
+
+	rows, err := tx.Query(`
+		SELECT article_id, alias
+		FROM article_alias
+		WHERE `+inSql+`
+		ORDER BY alias
+	`, inArgs...)
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var alias string
+
+		if err := rows.Scan(&id, &alias); err != nil {
+			return err
+		}
+
+		if a, ok := articlesById[id]; ok {
+			a.Aliases = append(a.Aliases, alias)
+		}
+	}
+
+	return rows.Err()
+}
+
+const selectArticleColumns = `
+	SELECT
+		a.article_id,
+		a.slug,
+		a.published,
+		a.updated,
+		a.hidden,
+		a.title,
+		a.summary_html,
+		a.full_html,
+		a.list_html,
+		a.extra,
+		a.series,
+		a.series_order,
+		a.word_count,
+		a.reading_time,
+		a.toc,
+		a.bundle_dir
+`
+
+func (s *sqlStore) articles(tx *sql.Tx, f Filter) ([]article.Article, int, error) {
+	fromWhere, args := s.filterSql(f)
+
+	var total int
+	if err := tx.QueryRow(`SELECT COUNT(*) `+fromWhere, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := selectArticleColumns + fromWhere
+	switch {
+	case f.Series != "":
+		query += " ORDER BY a.series_order ASC, a.published ASC, a.slug ASC"
+	case f.Ascending:
+		query += " ORDER BY a.published ASC, a.slug ASC"
+	default:
+		query += " ORDER BY a.published DESC, a.slug DESC"
+	}
+
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	articles, err := articlesFromRows(tx, rows)
+	return articles, total, err
+}
+
+func (s *sqlStore) Articles(f Filter) ([]article.Article, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	articles, total, err := s.articles(tx, f)
+	err = dbutils.TxCommitIfOk(tx, err)
+	return articles, total, err
+}
+
+func (s *sqlStore) Related(slug string, limit int) ([]article.Article, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	visible, args := visibleCondition()
+	args = append([]interface{}{slug}, args...)
+	args = append(args, limit)
+
+	var articles []article.Article
+	rows, err := tx.Query(selectArticleColumns+`
+		FROM article a
+		INNER JOIN article_related r
+			ON r.related_slug = a.slug
+		INNER JOIN article o
+			ON o.article_id = r.article_id
+		WHERE o.slug = ? AND `+visible+`
+		ORDER BY r.position ASC
+		LIMIT ?
+	`, args...)
+	if err == nil {
+		articles, err = articlesFromRows(tx, rows)
+	}
+
+	err = dbutils.TxCommitIfOk(tx, err)
+	return articles, err
+}
+
+func (s *sqlStore) ArchiveCounts(year, month int) (map[int]int, error) {
+	var byExpr string
+	visible, args := visibleCondition()
+	where := []string{visible}
+
+	switch {
+	case year == 0:
+		byExpr = s.dialect.datePart("year", "a.published")
+	case month == 0:
+		byExpr = s.dialect.datePart("month", "a.published")
+		where = append(where, s.dialect.datePart("year", "a.published")+" = ?")
+		args = append(args, year)
+	default:
+		byExpr = s.dialect.datePart("day", "a.published")
+		where = append(where,
+			s.dialect.datePart("year", "a.published")+" = ?",
+			s.dialect.datePart("month", "a.published")+" = ?",
+		)
+		args = append(args, year, month)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+byExpr+`, COUNT(*)
+		FROM article a
+		WHERE `+strings.Join(where, " AND ")+`
+		GROUP BY `+byExpr+`
+	`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var k, v int
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+
+		counts[k] = v
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (s *sqlStore) TagCounts() (map[string]int, error) {
+	visible, args := visibleCondition()
+	rows, err := s.db.Query(`
+		SELECT
+			t.tag,
+			COUNT(*)
+		FROM article_tag t
+		INNER JOIN article a
+			ON a.article_id = t.article_id
+		WHERE `+visible+`
+		GROUP BY t.tag
+	`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var k string
+		var v int
+
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+
+		counts[k] = v
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (s *sqlStore) Scheduled() ([]article.Article, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var articles []article.Article
+	rows, err := tx.Query(selectArticleColumns+`
+		FROM article a
+		WHERE a.published > ?
+		ORDER BY a.published ASC
+	`, now())
+	if err == nil {
+		articles, err = articlesFromRows(tx, rows)
+	}
+
+	err = dbutils.TxCommitIfOk(tx, err)
+	return articles, err
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) driverName() string { return "sqlite" }
+
+var sqliteDateFormats = map[string]string{
+	"year":  "%Y",
+	"month": "%m",
+	"day":   "%d",
+}
+
+func (sqliteDialect) datePart(part, expr string) string {
+	return "CAST(strftime('" + sqliteDateFormats[part] + "', " + expr + ") AS INTEGER)"
+}
+
+func (sqliteDialect) tableExists() string {
+	return `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+
+var sqliteLikeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// searchCondition falls back to a simple substring search, SQLite has no FULLTEXT indexes like MySQL
+func (sqliteDialect) searchCondition(q string) (string, []interface{}) {
+	pattern := "%" + sqliteLikeEscaper.Replace(q) + "%"
+	return `(a.full_plain LIKE ? ESCAPE '\' OR a.title LIKE ? ESCAPE '\')`, []interface{}{pattern, pattern}
+}
@@ -0,0 +1,118 @@
+// Package store provides persistence for articles with interchangeable database backends.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"code.laria.me/laria.me/article"
+)
+
+var ErrUnknownDriver = errors.New("unknown database driver")
+
+// Filter selects articles in Store.Articles. Zero values don't restrict the result.
+type Filter struct {
+	Slug             string
+	Tag              string
+	Year, Month, Day int
+	// Alias selects the article that has the given alias
+	Alias string
+	// LinksTo selects the articles linking to the article with the given slug
+	LinksTo string
+	// Series selects the articles of a series. They will be ordered by their position in the series,
+	// Ascending is ignored then.
+	Series string
+	// PublishedBefore and PublishedAfter restrict the publishing date, exclusive of the given time
+	PublishedBefore, PublishedAfter time.Time
+	// TieSlug breaks ties for PublishedBefore and PublishedAfter: Articles published at exactly the given time
+	// match too, if their slug sorts before (PublishedBefore) or after (PublishedAfter) TieSlug.
+	// This matches the order of articles with the same publishing date.
+	TieSlug string
+	// Search is a full text search query
+	Search string
+	// Ascending sorts the articles by publishing date in ascending order instead of descending
+	Ascending bool
+	// Limit restricts the number of returned articles, unless it is 0
+	Limit  int
+	Offset int
+}
+
+// Store persists articles. Apart from Scheduled, all queries only consider visible articles,
+// i.e. articles that are not hidden and whose publishing date has passed.
+type Store interface {
+	// SaveArticle creates or updates an article, identified by its slug
+	SaveArticle(a article.Article) error
+	// DeleteArticlesExcept deletes all articles whose slug is not in slugs
+	DeleteArticlesExcept(slugs []string) error
+
+	// Articles returns the articles matching the filter and the total number of matches,
+	// ignoring Limit and Offset
+	Articles(filter Filter) ([]article.Article, int, error)
+	// ArchiveCounts counts articles by year, if year is 0; by month of the year, if month is 0;
+	// by day of the month otherwise.
+	ArchiveCounts(year, month int) (map[int]int, error)
+	// Related returns up to limit visible articles related to the article with the given slug, most related first
+	Related(slug string, limit int) ([]article.Article, error)
+	// TagCounts counts articles by tag
+	TagCounts() (map[string]int, error)
+	// Scheduled returns all articles with a publishing date in the future, including hidden ones
+	Scheduled() ([]article.Article, error)
+
+	// Migrations returns all known schema migrations, ordered by version
+	Migrations() ([]Migration, error)
+	// Migrate applies all pending schema migrations and returns them
+	Migrate() ([]Migration, error)
+
+	Close() error
+}
+
+// Open opens a store using the named driver ("mysql" or "sqlite")
+func Open(driver, dsn string) (Store, error) {
+	var d dialect
+	switch driver {
+	case "", "mysql":
+		d = mysqlDialect{}
+	case "sqlite":
+		d = sqliteDialect{}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownDriver, driver)
+	}
+
+	db, err := sql.Open(d.driverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db: db, dialect: d}, nil
+}
+
+const dbDateFormat = "2006-01-02 15:04:05"
+
+// nullTime scans datetime values, no matter if the driver returns them as time.Time or as text
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (nt *nullTime) Scan(value interface{}) error {
+	var err error
+
+	switch v := value.(type) {
+	case nil:
+		nt.Time, nt.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		nt.Time = v
+	case []byte:
+		nt.Time, err = time.Parse(dbDateFormat, string(v))
+	case string:
+		nt.Time, err = time.Parse(dbDateFormat, v)
+	default:
+		err = fmt.Errorf("can not scan %T into a time", value)
+	}
+
+	nt.Valid = err == nil
+	return err
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.laria.me/laria.me/article"
+)
+
+func date(y, m, d int) time.Time {
+	return time.Date(y, time.Month(m), d, 10, 0, 0, 0, time.UTC)
+}
+
+func tags(names ...string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	return set
+}
+
+var testArticles = []article.Article{
+	{
+		Slug:      "alpha",
+		Title:     "Alpha",
+		Published: date(2020, 1, 2),
+		Tags:      tags("go", "web"),
+		Aliases:   []string{"old-alpha"},
+		FullPlain: "All about tokenizers",
+	},
+	{
+		// Published at the same time as alpha, the slug breaks the tie
+		Slug:        "beta",
+		Title:       "Beta",
+		Published:   date(2020, 1, 2),
+		Tags:        tags("go"),
+		Series:      "intro",
+		SeriesOrder: 2,
+	},
+	{
+		Slug:        "gamma",
+		Title:       "Gamma",
+		Published:   date(2021, 3, 4),
+		Tags:        tags("web"),
+		Series:      "intro",
+		SeriesOrder: 1,
+		Links:       []string{"alpha"},
+	},
+	{
+		Slug:      "hidden",
+		Title:     "Hidden",
+		Published: date(2019, 5, 6),
+		Hidden:    true,
+		Tags:      tags("go"),
+	},
+	{
+		Slug:      "future",
+		Title:     "Future",
+		Published: date(2999, 1, 1),
+		Tags:      tags("web"),
+	},
+}
+
+// testStores runs f against every backend, filled with testArticles
+func testStores(t *testing.T, f func(t *testing.T, st Store)) {
+	backends := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemory(false)
+		},
+		"sqlite": func(t *testing.T) Store {
+			st, err := Open("sqlite", filepath.Join(t.TempDir(), "test.sqlite"))
+			if err != nil {
+				t.Fatalf("Open failed: %s", err)
+			}
+			if _, err := st.Migrate(); err != nil {
+				t.Fatalf("Migrate failed: %s", err)
+			}
+			return st
+		},
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			st := open(t)
+			defer st.Close()
+
+			for _, a := range testArticles {
+				if err := st.SaveArticle(a); err != nil {
+					t.Fatalf("SaveArticle(%s) failed: %s", a.Slug, err)
+				}
+			}
+
+			f(t, st)
+		})
+	}
+}
+
+func slugs(articles []article.Article) []string {
+	list := make([]string, 0, len(articles))
+	for _, a := range articles {
+		list = append(list, a.Slug)
+	}
+	return list
+}
+
+func TestArticles(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+		total  int
+	}{
+		{"all", Filter{}, []string{"gamma", "beta", "alpha"}, 3},
+		{"ascending", Filter{Ascending: true}, []string{"alpha", "beta", "gamma"}, 3},
+		{"slug", Filter{Slug: "beta"}, []string{"beta"}, 1},
+		{"hidden slug", Filter{Slug: "hidden"}, []string{}, 0},
+		{"tag", Filter{Tag: "go"}, []string{"beta", "alpha"}, 2},
+		{"date", Filter{Year: 2020, Month: 1, Day: 2}, []string{"beta", "alpha"}, 2},
+		{"year", Filter{Year: 2021}, []string{"gamma"}, 1},
+		{"alias", Filter{Alias: "old-alpha"}, []string{"alpha"}, 1},
+		{"links to", Filter{LinksTo: "alpha"}, []string{"gamma"}, 1},
+		{"series", Filter{Series: "intro"}, []string{"gamma", "beta"}, 2},
+		{"published before", Filter{PublishedBefore: date(2021, 3, 4)}, []string{"beta", "alpha"}, 2},
+		{"published after", Filter{PublishedAfter: date(2020, 1, 2)}, []string{"gamma"}, 1},
+		{"before with tie", Filter{PublishedBefore: date(2020, 1, 2), TieSlug: "beta"}, []string{"alpha"}, 1},
+		{"after with tie", Filter{PublishedAfter: date(2020, 1, 2), TieSlug: "alpha", Ascending: true}, []string{"beta", "gamma"}, 2},
+		{"search text", Filter{Search: "Tokenizer"}, []string{"alpha"}, 1},
+		{"search title", Filter{Search: "gamm"}, []string{"gamma"}, 1},
+		{"search nothing", Filter{Search: "100%"}, []string{}, 0},
+		{"limit", Filter{Limit: 2}, []string{"gamma", "beta"}, 3},
+		{"offset", Filter{Limit: 2, Offset: 2}, []string{"alpha"}, 3},
+	}
+
+	testStores(t, func(t *testing.T, st Store) {
+		for _, test := range tests {
+			articles, total, err := st.Articles(test.filter)
+			if err != nil {
+				t.Errorf("%s: Articles failed: %s", test.name, err)
+				continue
+			}
+
+			if got := slugs(articles); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: got articles %v, want %v", test.name, got, test.want)
+			}
+			if total != test.total {
+				t.Errorf("%s: got total %d, want %d", test.name, total, test.total)
+			}
+		}
+	})
+}
+
+func TestArticlesLoadsDetails(t *testing.T) {
+	testStores(t, func(t *testing.T, st Store) {
+		articles, _, err := st.Articles(Filter{Slug: "alpha"})
+		if err != nil {
+			t.Fatalf("Articles failed: %s", err)
+		}
+		if len(articles) != 1 {
+			t.Fatalf("got %d articles, want 1", len(articles))
+		}
+
+		a := articles[0]
+		if a.Title != "Alpha" || !a.Published.Equal(date(2020, 1, 2)) {
+			t.Errorf("got title %q, published %s", a.Title, a.Published)
+		}
+		if !reflect.DeepEqual(a.Tags, tags("go", "web")) {
+			t.Errorf("got tags %v", a.Tags)
+		}
+		if !reflect.DeepEqual(a.Aliases, []string{"old-alpha"}) {
+			t.Errorf("got aliases %v", a.Aliases)
+		}
+	})
+}
+
+func TestArchiveCounts(t *testing.T) {
+	tests := []struct {
+		year, month int
+		want        map[int]int
+	}{
+		{0, 0, map[int]int{2020: 2, 2021: 1}},
+		{2020, 0, map[int]int{1: 2}},
+		{2020, 1, map[int]int{2: 2}},
+		{2020, 2, map[int]int{}},
+	}
+
+	testStores(t, func(t *testing.T, st Store) {
+		for _, test := range tests {
+			counts, err := st.ArchiveCounts(test.year, test.month)
+			if err != nil {
+				t.Errorf("ArchiveCounts(%d, %d) failed: %s", test.year, test.month, err)
+				continue
+			}
+
+			if !reflect.DeepEqual(counts, test.want) {
+				t.Errorf("ArchiveCounts(%d, %d): got %v, want %v", test.year, test.month, counts, test.want)
+			}
+		}
+	})
+}
+
+func TestTagCounts(t *testing.T) {
+	testStores(t, func(t *testing.T, st Store) {
+		counts, err := st.TagCounts()
+		if err != nil {
+			t.Fatalf("TagCounts failed: %s", err)
+		}
+
+		if want := map[string]int{"go": 2, "web": 2}; !reflect.DeepEqual(counts, want) {
+			t.Errorf("got %v, want %v", counts, want)
+		}
+	})
+}
+
+func TestScheduled(t *testing.T) {
+	testStores(t, func(t *testing.T, st Store) {
+		articles, err := st.Scheduled()
+		if err != nil {
+			t.Fatalf("Scheduled failed: %s", err)
+		}
+
+		if got, want := slugs(articles), []string{"future"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDeleteArticlesExcept(t *testing.T) {
+	testStores(t, func(t *testing.T, st Store) {
+		if err := st.DeleteArticlesExcept([]string{"alpha", "gamma"}); err != nil {
+			t.Fatalf("DeleteArticlesExcept failed: %s", err)
+		}
+
+		articles, total, err := st.Articles(Filter{})
+		if err != nil {
+			t.Fatalf("Articles failed: %s", err)
+		}
+		if got, want := slugs(articles), []string{"gamma", "alpha"}; !reflect.DeepEqual(got, want) || total != 2 {
+			t.Errorf("got %v (total %d), want %v", got, total, want)
+		}
+
+		counts, err := st.TagCounts()
+		if err != nil {
+			t.Fatalf("TagCounts failed: %s", err)
+		}
+		if want := map[string]int{"go": 1, "web": 2}; !reflect.DeepEqual(counts, want) {
+			t.Errorf("got tag counts %v, want %v", counts, want)
+		}
+
+		scheduled, err := st.Scheduled()
+		if err != nil {
+			t.Fatalf("Scheduled failed: %s", err)
+		}
+		if len(scheduled) != 0 {
+			t.Errorf("got scheduled articles %v, want none", slugs(scheduled))
+		}
+
+		// An empty list is ignored instead of deleting everything
+		if err := st.DeleteArticlesExcept(nil); err != nil {
+			t.Fatalf("DeleteArticlesExcept(nil) failed: %s", err)
+		}
+		if _, total, _ := st.Articles(Filter{}); total != 2 {
+			t.Errorf("got %d articles after DeleteArticlesExcept(nil), want 2", total)
+		}
+	})
+}
+
+func TestVisibleAtWallClock(t *testing.T) {
+	// Publication times are wall clock times, so articles become visible at the local time, in every backend
+	now := article.WallClock(time.Now()).Truncate(time.Second)
+	recent := article.Article{Slug: "recent", Title: "Recent", Published: now.Add(-time.Minute)}
+	soon := article.Article{Slug: "soon", Title: "Soon", Published: now.Add(time.Hour)}
+
+	testStores(t, func(t *testing.T, st Store) {
+		for _, a := range []article.Article{recent, soon} {
+			if err := st.SaveArticle(a); err != nil {
+				t.Fatalf("SaveArticle(%s) failed: %s", a.Slug, err)
+			}
+		}
+
+		articles, _, err := st.Articles(Filter{Limit: 1})
+		if err != nil {
+			t.Fatalf("Articles failed: %s", err)
+		}
+		if got, want := slugs(articles), []string{"recent"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got articles %v, want %v", got, want)
+		}
+
+		scheduled, err := st.Scheduled()
+		if err != nil {
+			t.Fatalf("Scheduled failed: %s", err)
+		}
+		if got, want := slugs(scheduled), []string{"soon", "future"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got scheduled %v, want %v", got, want)
+		}
+	})
+}
@@ -1,19 +1,29 @@
 package main
 
 import (
-	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"code.laria.me/laria.me/article"
 	"code.laria.me/laria.me/config"
 	"code.laria.me/laria.me/environment"
+	"code.laria.me/laria.me/htmltransform"
+	"code.laria.me/laria.me/markdown"
+	"code.laria.me/laria.me/related"
+	"code.laria.me/laria.me/store"
+	"golang.org/x/net/html"
 )
 
-func allArticlesFromDir(dir string) ([]article.Article, error) {
+// regularFilesInDir lists the files (but not directories) in dir
+func regularFilesInDir(dir string) ([]string, error) {
 	f, err := os.Open(dir)
 	if err != nil {
 		return nil, err
@@ -25,47 +35,407 @@ func allArticlesFromDir(dir string) ([]article.Article, error) {
 		return nil, err
 	}
 
-	articles := make([]article.Article, 0)
-
+	filenames := make([]string, 0, len(infos))
 	for _, info := range infos {
 		if info.IsDir() {
 			continue
 		}
 
-		fullname := filepath.Join(dir, info.Name())
-		a, err := article.LoadArticle(fullname)
+		filenames = append(filenames, filepath.Join(dir, info.Name()))
+	}
+
+	return filenames, nil
+}
+
+// bundlesInDir lists the directories in dir that contain an article bundle
+func bundlesInDir(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	bundles := make([]string, 0)
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		bundle := filepath.Join(dir, info.Name())
+		indexInfo, err := os.Stat(filepath.Join(bundle, article.BundleIndex))
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return nil, err
+		case indexInfo.Mode().IsRegular():
+			bundles = append(bundles, bundle)
+		}
+	}
+
+	return bundles, nil
+}
+
+// logImageWarnings logs the images of an article that could not be processed. Other warnings are left to check,
+// but these images silently lose their attributes otherwise.
+func logImageWarnings(a article.Article) {
+	for _, warning := range a.Warnings {
+		var imageErr *markdown.ImageError
+		if errors.As(warning, &imageErr) {
+			log.Print(warning)
+		}
+	}
+}
+
+func allArticlesFromDir(dir string, md *markdown.Parser) ([]article.Article, error) {
+	filenames, err := regularFilesInDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	bundles, err := bundlesInDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	articles := make([]article.Article, 0, len(filenames)+len(bundles))
+
+	for _, filename := range filenames {
+		a, err := article.LoadArticle(filename, md)
+		if err != nil {
+			return nil, err
+		}
+
+		logImageWarnings(a)
+		articles = append(articles, a)
+	}
+
+	for _, bundle := range bundles {
+		a, err := article.LoadBundle(bundle, md)
 		if err != nil {
 			return nil, err
 		}
 
+		logImageWarnings(a)
 		articles = append(articles, a)
 	}
 
 	return articles, nil
 }
 
-func updateArticles(conf *config.Config, db *sql.DB) {
+// slugCollisions reports all articles using a slug or alias that is already used by another article
+func slugCollisions(articles []article.Article) []*article.ParseError {
+	collisions := make([]*article.ParseError, 0)
+
+	filenames := make(map[string]string)
+	for _, a := range articles {
+		if other, ok := filenames[a.Slug]; ok {
+			collisions = append(collisions, &article.ParseError{
+				File: a.Filename,
+				Err:  fmt.Errorf("duplicate slug %q, also used by %s", a.Slug, other),
+			})
+			continue
+		}
+
+		filenames[a.Slug] = a.Filename
+	}
+
+	// Aliases are checked after all slugs are known, a slug always wins against an alias
+	for _, a := range articles {
+		for _, alias := range a.Aliases {
+			if other, ok := filenames[alias]; ok {
+				collisions = append(collisions, &article.ParseError{
+					File: a.Filename,
+					Err:  fmt.Errorf("alias %q is already used by %s", alias, other),
+				})
+				continue
+			}
+
+			filenames[alias] = a.Filename
+		}
+	}
+
+	return collisions
+}
+
+// sanitizeArticle sanitizes the HTML of an article from an untrusted source and logs what was removed
+func sanitizeArticle(conf *config.Config, a *article.Article) error {
+	if !conf.IsUntrusted(a.Filename) {
+		return nil
+	}
+
+	policy := conf.SanitizePolicy()
+
+	full, removed, err := policy.Sanitize(a.FullHtml)
+	if err != nil {
+		return err
+	}
+
+	for _, what := range removed {
+		log.Printf("%s: removed %s", a.Filename, what)
+	}
+
+	// The summary is a part of the full text, so everything removed was already reported
+	summary, _, err := policy.Sanitize(a.SummaryHtml)
+	if err != nil {
+		return err
+	}
+
+	a.FullHtml = full
+	a.SummaryHtml = summary
+	return a.AnalyzeText()
+}
+
+const quicklinkPrefix = "/blog/q/"
+
+// resolveQuicklinks creates a function for htmltransform.RewriteLinks that replaces quicklinks
+// to known articles with the article URL, saving the reader a redirect
+func resolveQuicklinks(articles []article.Article) func(string) string {
+	urls := articleUrls(articles)
+
+	return func(href string) string {
+		u, err := url.Parse(href)
+		if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, quicklinkPrefix) {
+			return href
+		}
+
+		target, ok := urls[strings.TrimPrefix(u.Path, quicklinkPrefix)]
+		if !ok {
+			return href
+		}
+
+		if u.Fragment != "" {
+			target += "#" + u.Fragment
+		}
+		return target
+	}
+}
+
+// imageDefaults are added to all images in articles that don't set these attributes themselves
+var imageDefaults = []html.Attribute{
+	{Key: "loading", Val: "lazy"},
+	{Key: "decoding", Val: "async"},
+}
+
+// bundleUrlResolver creates a function for htmltransform.RewriteLinks and RewriteImageSources that
+// resolves relative URLs in the article of a bundle against the article URL, under which its files are served.
+// Since the URLs become absolute, they also work in article lists.
+func bundleUrlResolver(a article.Article) func(string) string {
+	base := &url.URL{Path: articleUrl(a) + "/"}
+
+	return func(href string) string {
+		u, err := url.Parse(href)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return href
+		}
+
+		return base.ResolveReference(u).String()
+	}
+}
+
+// transformArticleHtml does all rewriting of the articles' HTML once, so serving them needs none.
+// Sets ListHtml from the summary or the full text.
+func transformArticleHtml(conf *config.Config, articles []article.Article) error {
+	resolve := resolveQuicklinks(articles)
+
+	full := htmltransform.Pipeline{
+		htmltransform.RewriteLinks(resolve),
+		htmltransform.ImageAttributes(imageDefaults),
+	}
+	if conf.HeadingAnchors {
+		full = append(full, htmltransform.HeadingAnchors())
+	}
+
+	list := htmltransform.Pipeline{
+		htmltransform.RewriteLinks(resolve),
+		htmltransform.ImageAttributes(imageDefaults),
+		// Lists show the headings of articles one level higher
+		htmltransform.ShiftHeadings(-1),
+	}
+
+	for i := range articles {
+		a := &articles[i]
+
+		listSource := a.SummaryHtml
+		if listSource == "" {
+			listSource = a.FullHtml
+		}
+
+		articleList, articleFull := list, full
+		if a.BundleDir != "" {
+			resolveBundleUrl := bundleUrlResolver(*a)
+			bundle := htmltransform.Pipeline{
+				htmltransform.RewriteLinks(resolveBundleUrl),
+				htmltransform.RewriteImageSources(resolveBundleUrl),
+			}
+
+			articleList = append(bundle, list...)
+			articleFull = append(bundle, full...)
+		}
+
+		var err error
+		if a.ListHtml, err = articleList.Apply(listSource); err != nil {
+			return fmt.Errorf("%s: %w", a.Filename, err)
+		}
+
+		if a.FullHtml, err = articleFull.Apply(a.FullHtml); err != nil {
+			return fmt.Errorf("%s: %w", a.Filename, err)
+		}
+	}
+
+	return nil
+}
+
+// joinParseErrors combines multiple errors into one, reporting each of them on its own line
+func joinParseErrors(errs []*article.ParseError) error {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// linkedArticleName returns the slug or alias of the article an internal link points to
+func linkedArticleName(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+
+	// Links to an article are either /blog/{year}/{month}/{day}/{slug} or a quicklink, /blog/q/{slug}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) == 5 && parts[0] == "blog":
+		return parts[4], true
+	case len(parts) == 3 && parts[0] == "blog" && parts[1] == "q":
+		return parts[2], true
+	default:
+		return "", false
+	}
+}
+
+// linkedArticle returns the slug of the article an internal link points to, given a map of all slugs
+// and aliases to the slugs of their articles
+func linkedArticle(href string, slugs map[string]string) (string, bool) {
+	name, ok := linkedArticleName(href)
+	if !ok {
+		return "", false
+	}
+
+	slug, ok := slugs[name]
+	return slug, ok
+}
+
+// setArticleLinks finds the links between articles. Must be run after all links were resolved.
+func setArticleLinks(articles []article.Article) error {
+	slugs := make(map[string]string)
+	for _, a := range articles {
+		slugs[a.Slug] = a.Slug
+		for _, alias := range a.Aliases {
+			slugs[alias] = a.Slug
+		}
+	}
+
+	for i := range articles {
+		a := &articles[i]
+
+		hrefs, err := htmltransform.Links(a.FullHtml)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.Filename, err)
+		}
+
+		seen := make(map[string]struct{})
+		a.Links = make([]string, 0)
+		for _, href := range hrefs {
+			slug, ok := linkedArticle(href, slugs)
+			if !ok || slug == a.Slug {
+				continue
+			}
+
+			if _, ok := seen[slug]; !ok {
+				seen[slug] = struct{}{}
+				a.Links = append(a.Links, slug)
+			}
+		}
+	}
+
+	return nil
+}
+
+// maxRelatedArticles is the number of related articles stored per article
+const maxRelatedArticles = 10
+
+func loadAllArticles(conf *config.Config, md *markdown.Parser) ([]article.Article, error) {
 	articles := []article.Article{}
 	for _, dir := range conf.ArticleDirs {
-		dirArticles, err := allArticlesFromDir(dir)
+		dirArticles, err := allArticlesFromDir(dir, md)
 		if err != nil {
-			log.Fatalf("allArticlesFromDir(%s): %s", dir, err)
+			return nil, fmt.Errorf("allArticlesFromDir(%s): %w", dir, err)
 		}
 
 		articles = append(articles, dirArticles...)
 	}
 
+	if collisions := slugCollisions(articles); len(collisions) > 0 {
+		return nil, joinParseErrors(collisions)
+	}
+
+	pages, err := pageNamesInDir(path.Join(conf.ContentRoot, "pages"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Before sanitizing, which would remove the links with their unknown scheme
+	if problems := resolveArticleWikiLinks(articles, pages); len(problems) > 0 {
+		return nil, joinParseErrors(problems)
+	}
+
+	for i := range articles {
+		if err := sanitizeArticle(conf, &articles[i]); err != nil {
+			return nil, fmt.Errorf("sanitizeArticle(%s): %w", articles[i].Filename, err)
+		}
+
+		if err := articles[i].AutoSummarize(conf.AutoSummary.Paragraphs, conf.AutoSummary.Words); err != nil {
+			return nil, fmt.Errorf("AutoSummarize(%s): %w", articles[i].Filename, err)
+		}
+	}
+
+	related.Assign(articles, maxRelatedArticles, article.WallClock(time.Now()))
+
+	if err := transformArticleHtml(conf, articles); err != nil {
+		return nil, fmt.Errorf("transformArticleHtml: %w", err)
+	}
+
+	if err := setArticleLinks(articles); err != nil {
+		return nil, fmt.Errorf("setArticleLinks: %w", err)
+	}
+
+	return articles, nil
+}
+
+func updateArticles(conf *config.Config, md *markdown.Parser, st store.Store) {
+	articles, err := loadAllArticles(conf, md)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	slugs := make([]string, 0, len(articles))
 	for _, article := range articles {
-		if _, err := article.SaveToDb(db); err != nil {
-			log.Fatalf("SaveToDb: %s", err)
+		if err := st.SaveArticle(article); err != nil {
+			log.Fatalf("SaveArticle: %s", err)
 		}
 
 		slugs = append(slugs, article.Slug)
 	}
 
-	if err := article.DeleteArticlesFromDbExcept(db, slugs); err != nil {
-		log.Fatalf("DeleteArticlesFromDbExcept: %s", err)
+	if err := st.DeleteArticlesExcept(slugs); err != nil {
+		log.Fatalf("DeleteArticlesExcept: %s", err)
 	}
 }
 
@@ -75,12 +445,17 @@ func cmdUpdate(progname string, env *environment.Env, args []string) {
 		log.Fatalf("env.Config() failed: %s", err)
 	}
 
-	db, err := env.DB()
+	st, err := env.Store()
 	if err != nil {
-		log.Fatalf("env.Config() failed: %s", err)
+		log.Fatalf("env.Store() failed: %s", err)
+	}
+
+	md, err := env.Markdown()
+	if err != nil {
+		log.Fatalf("env.Markdown() failed: %s", err)
 	}
 
-	updateArticles(conf, db)
+	updateArticles(conf, md, st)
 
 	resp, err := http.PostForm(conf.UpdateUrl, url.Values{"secret": {conf.Secret}})
 	if err != nil {
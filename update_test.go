@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"code.laria.me/laria.me/article"
+)
+
+func TestSlugCollisions(t *testing.T) {
+	articles := []article.Article{
+		{Slug: "a", Filename: "a.md"},
+		{Slug: "b", Filename: "b.md"},
+		{Slug: "a", Filename: "other/a.md"},
+		{Slug: "c", Filename: "c.md", Aliases: []string{"old-c", "b"}},
+		{Slug: "d", Filename: "d.md", Aliases: []string{"old-c"}},
+	}
+
+	got := make([]string, 0)
+	for _, collision := range slugCollisions(articles) {
+		got = append(got, collision.Error())
+	}
+
+	want := []string{
+		`other/a.md: duplicate slug "a", also used by a.md`,
+		`c.md: alias "b" is already used by b.md`,
+		`d.md: alias "old-c" is already used by c.md`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got collisions %q, want %q", got, want)
+	}
+
+	if collisions := slugCollisions(articles[:2]); len(collisions) != 0 {
+		t.Errorf("got collisions %v for unique slugs", collisions)
+	}
+}
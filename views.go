@@ -8,9 +8,11 @@ import (
 	"math"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"code.laria.me/laria.me/article"
 	"code.laria.me/laria.me/menu"
 )
 
@@ -85,11 +87,48 @@ type RootData struct {
 
 type ViewArticle struct {
 	Published time.Time
+	Updated   time.Time
 	Slug      string
 	Title     string
 	Content   template.HTML
 	ReadMore  bool
 	Tags      []string
+	Extra     map[string]interface{}
+	WordCount int
+	// ReadingMinutes is the estimated reading time, rounded up to whole minutes
+	ReadingMinutes int
+	// Draft is set for hidden or not yet published articles (only shown in previews)
+	Draft bool
+	// Prev and Next are the chronologically adjacent articles, only set when viewing a single article
+	Prev, Next *ViewArticleLink
+	// NavTag is the tag that navigating to the previous or next article is limited to, if any
+	NavTag string
+	// Toc is the table of contents, only set for articles with enough headings
+	Toc []article.TocEntry
+	// Related are related articles, only set when viewing a single article
+	Related []ViewArticleLink
+	// ReferencedBy are the articles linking to this one, newest first, followed by the linking pages.
+	// Only set when viewing a single article.
+	ReferencedBy []ViewArticleLink
+	// Series is only set for articles that are part of a series and only when viewing a single article
+	Series *ViewSeries
+}
+
+type ViewArticleLink struct {
+	Url   string
+	Title string
+}
+
+type ViewSeriesPart struct {
+	Url     string
+	Title   string
+	Current bool
+}
+
+type ViewSeries struct {
+	Name       string
+	Parts      []ViewSeriesPart
+	Prev, Next *ViewSeriesPart
 }
 
 type Views struct {
@@ -101,9 +140,11 @@ type Views struct {
 	blog         *template.Template
 	content      *template.Template
 	search       *template.Template
+	series       *template.Template
 	start        *template.Template
 	tag          *template.Template
 	tags         *template.Template
+	static       bool
 }
 
 func monthText(m int) string {
@@ -161,16 +202,21 @@ type paginationTemplateData struct {
 	Pages  int
 }
 
-var paginationTemplate = template.Must(template.New("").Funcs(template.FuncMap{"seq": func(max int) <-chan int {
-	ch := make(chan int)
-	go func() {
-		defer close(ch)
-		for i := 1; i <= max; i++ {
-			ch <- i
-		}
-	}()
-	return ch
-}}).Parse(`<form action="{{.Action}}" method="get" class="pagination">
+var paginationFuncs = template.FuncMap{
+	"seq": func(max int) <-chan int {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 1; i <= max; i++ {
+				ch <- i
+			}
+		}()
+		return ch
+	},
+	"static_page_url": staticPageUrl,
+}
+
+var paginationTemplate = template.Must(template.New("").Funcs(paginationFuncs).Parse(`<form action="{{.Action}}" method="get" class="pagination">
 	{{- range .Args -}}
 		<input type="hidden" name="{{.K}}" value="{{.V}}">
 	{{- end -}}
@@ -182,6 +228,25 @@ var paginationTemplate = template.Must(template.New("").Funcs(template.FuncMap{"
 	<button type="submit">Go to</button>
 </form>`))
 
+// staticPaginationTemplate renders the pagination as plain links, since static sites can't evaluate query arguments.
+var staticPaginationTemplate = template.Must(template.New("").Funcs(paginationFuncs).Parse(`<span class="pagination">
+	{{- $cur := .Cur -}}
+	{{- $action := .Action -}}
+	Page:
+	{{- range (seq .Pages) }}
+		{{if eq . $cur}}<strong>{{.}}</strong>{{else}}<a href="{{static_page_url $action .}}">{{.}}</a>{{end}}
+	{{- end -}}
+</span>`))
+
+// staticPageUrl returns the URL of a page of a paginated listing in a static export
+func staticPageUrl(action string, page int) string {
+	if page <= 1 {
+		return action
+	}
+
+	return fmt.Sprintf("%s/page/%d", action, page)
+}
+
 func normalizeDate(y, m, d int) (int, int, int) {
 	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
 	y, month, d := t.Date()
@@ -193,7 +258,25 @@ func dayText(y, m, d int) string {
 	return fmt.Sprintf("%s %s %d", nth(d), monthText(m), y)
 }
 
+// LoadViews loads the views from the templates in templatesDir
 func LoadViews(templatesDir string) (Views, error) {
+	return loadViews(templatesDir, paginationTemplate)
+}
+
+// LoadStaticViews is like LoadViews, but the views will be suited for a static export of the site
+func LoadStaticViews(templatesDir string) (Views, error) {
+	views, err := loadViews(templatesDir, staticPaginationTemplate)
+	views.static = true
+	return views, err
+}
+
+// TagNavigation reports whether navigating between articles can be limited to a tag (see ViewArticle.NavTag).
+// Static exports can't do this, since the tag is passed as a query argument.
+func (v Views) TagNavigation() bool {
+	return !v.static
+}
+
+func loadViews(templatesDir string, pagination *template.Template) (Views, error) {
 	views := Views{}
 
 	root, err := template.New("root.html").ParseFiles(path.Join(templatesDir, "root.html"))
@@ -232,7 +315,7 @@ func LoadViews(templatesDir string) (Views, error) {
 
 			buf := new(bytes.Buffer)
 
-			err := paginationTemplate.Execute(buf, paginationTemplateData{
+			err := pagination.Execute(buf, paginationTemplateData{
 				Action: path,
 				Args:   args,
 				Cur:    page,
@@ -282,6 +365,7 @@ func LoadViews(templatesDir string) (Views, error) {
 		"blog":          &(views.blog),
 		"content":       &(views.content),
 		"search":        &(views.search),
+		"series":        &(views.series),
 		"start":         &(views.start),
 		"tag":           &(views.tag),
 		"tags":          &(views.tags),
@@ -378,7 +462,7 @@ func (v Views) RenderArchiveYear(
 	year int,
 	countByMonth map[int]int,
 ) error {
-	return v.archiveYear.Execute(w, RootData{BuildViewMenu(menu, curMenu), string(year), struct {
+	return v.archiveYear.Execute(w, RootData{BuildViewMenu(menu, curMenu), strconv.Itoa(year), struct {
 		Year   int
 		Months archiveEntriesWithCount
 	}{
@@ -429,6 +513,22 @@ func (v Views) RenderSearch(
 	}})
 }
 
+func (v Views) RenderSeries(
+	w io.Writer,
+	menu *menu.Menu,
+	curMenu string,
+	name string,
+	articles []ViewArticle,
+) error {
+	return v.series.Execute(w, RootData{BuildViewMenu(menu, curMenu), "Series " + name, struct {
+		Name     string
+		Articles []ViewArticle
+	}{
+		Name:     name,
+		Articles: articles,
+	}})
+}
+
 func (v Views) RenderStart(
 	w io.Writer,
 	menu *menu.Menu,
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"code.laria.me/laria.me/article"
+	"code.laria.me/laria.me/htmltransform"
+	"code.laria.me/laria.me/markdown"
+	"code.laria.me/laria.me/store"
+)
+
+var errBrokenWikiLink = errors.New("broken wiki link")
+
+// articleUrls maps the slugs and aliases of articles to their URLs. Articles that are not public yet
+// are mapped to their quicklink, which starts working once they get published, unlike their dated URL.
+func articleUrls(articles []article.Article) map[string]string {
+	now := article.WallClock(time.Now())
+
+	urls := make(map[string]string)
+	for _, a := range articles {
+		url := articleUrl(a)
+		if !a.IsPublic(now) {
+			url = quicklinkPrefix + a.Slug
+		}
+
+		urls[a.Slug] = url
+		for _, alias := range a.Aliases {
+			urls[alias] = url
+		}
+	}
+	return urls
+}
+
+// wikiLinkTargets maps the targets of wiki links to URLs. Targets are article slugs and aliases
+// or page names. Articles win, if a page has the same name.
+func wikiLinkTargets(articles []article.Article, pages []string) map[string]string {
+	targets := articleUrls(articles)
+	for _, name := range pages {
+		if _, ok := targets[name]; !ok {
+			targets[name] = "/" + name
+		}
+	}
+	return targets
+}
+
+// resolveWikiLinks replaces the URLs of wiki links in html with the URLs of their targets.
+// Also returns the targets that could not be resolved. Their links get the URL returned by fallback,
+// or are left untouched, if fallback is nil.
+func resolveWikiLinks(html string, targets map[string]string, fallback func(target string) string) (string, []string, error) {
+	unresolved := make([]string, 0)
+
+	resolved, err := htmltransform.Pipeline{
+		htmltransform.RewriteLinks(func(href string) string {
+			target, ok := markdown.WikiLinkTarget(href)
+			if !ok {
+				return href
+			}
+
+			if url, ok := targets[target]; ok {
+				return url
+			}
+
+			unresolved = append(unresolved, target)
+			if fallback != nil {
+				return fallback(target)
+			}
+			return href
+		}),
+	}.Apply(html)
+
+	return resolved, unresolved, err
+}
+
+// resolveArticleWikiLinks resolves the wiki links in all articles. Returns a problem for every broken link.
+func resolveArticleWikiLinks(articles []article.Article, pages []string) []*article.ParseError {
+	targets := wikiLinkTargets(articles, pages)
+	problems := make([]*article.ParseError, 0)
+
+	for i := range articles {
+		a := &articles[i]
+
+		full, unresolved, err := resolveWikiLinks(a.FullHtml, targets, nil)
+		if err != nil {
+			problems = append(problems, &article.ParseError{File: a.Filename, Err: err})
+			continue
+		}
+
+		for _, target := range unresolved {
+			problems = append(problems, &article.ParseError{
+				File: a.Filename,
+				Err:  fmt.Errorf("%w to %q: no article or page with that name", errBrokenWikiLink, target),
+			})
+		}
+
+		// The summary is a part of the full text, so everything unresolved was already reported
+		summary, _, err := resolveWikiLinks(a.SummaryHtml, targets, nil)
+		if err != nil {
+			problems = append(problems, &article.ParseError{File: a.Filename, Err: err})
+			continue
+		}
+
+		a.FullHtml = full
+		a.SummaryHtml = summary
+	}
+
+	return problems
+}
+
+// pageNamesInDir lists the names of all pages in pagesPath
+func pageNamesInDir(pagesPath string) ([]string, error) {
+	filenames, err := regularFilesInDir(pagesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		if name := pageName(filepath.Base(filename)); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// pageWikiLinkTargets returns the targets of wiki links in pages: The pages in pagesPath, all visible
+// and all scheduled articles
+func pageWikiLinkTargets(pagesPath string, st store.Store) (map[string]string, error) {
+	pages, err := pageNamesInDir(pagesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	articles, _, err := st.Articles(store.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled, err := st.Scheduled()
+	if err != nil {
+		return nil, err
+	}
+
+	return wikiLinkTargets(append(articles, scheduled...), pages), nil
+}
+
+// quicklinkFallback links to the quicklink of an unknown target, which might be a hidden article,
+// so the link will start working once the article gets published
+func quicklinkFallback(filename string) func(string) string {
+	return func(target string) string {
+		log.Printf("%s: %s to %q, linking to its quicklink instead", filename, errBrokenWikiLink, target)
+		return quicklinkPrefix + target
+	}
+}
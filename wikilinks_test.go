@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"code.laria.me/laria.me/article"
+)
+
+func TestResolveWikiLinks(t *testing.T) {
+	targets := map[string]string{"a": "/blog/2020/1/2/a", "about": "/about"}
+
+	tests := []struct {
+		name           string
+		in             string
+		fallback       func(string) string
+		want           string
+		wantUnresolved []string
+	}{
+		{
+			name:           "resolved",
+			in:             `<a href="wiki:a">A</a> <a href="wiki:about">About</a> <a href="/other">Other</a>`,
+			want:           `<a href="/blog/2020/1/2/a">A</a> <a href="/about">About</a> <a href="/other">Other</a>`,
+			wantUnresolved: []string{},
+		},
+		{
+			name:           "unresolved",
+			in:             `<a href="wiki:nope">Nope</a> <a href="wiki:two%20words">Two</a>`,
+			want:           `<a href="wiki:nope">Nope</a> <a href="wiki:two%20words">Two</a>`,
+			wantUnresolved: []string{"nope", "two words"},
+		},
+		{
+			name:           "fallback",
+			in:             `<a href="wiki:nope">Nope</a>`,
+			fallback:       func(target string) string { return "#broken-" + target },
+			want:           `<a href="#broken-nope">Nope</a>`,
+			wantUnresolved: []string{"nope"},
+		},
+	}
+
+	for _, test := range tests {
+		got, unresolved, err := resolveWikiLinks(test.in, targets, test.fallback)
+		if err != nil {
+			t.Errorf("%s: resolveWikiLinks failed: %s", test.name, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(unresolved, test.wantUnresolved) {
+			t.Errorf("%s: got unresolved %q, want %q", test.name, unresolved, test.wantUnresolved)
+		}
+	}
+}
+
+func TestResolveArticleWikiLinks(t *testing.T) {
+	published := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	articles := []article.Article{
+		{
+			Slug:        "a",
+			Published:   published,
+			Aliases:     []string{"old-a"},
+			Filename:    "a.md",
+			SummaryHtml: `<a href="wiki:b">b</a>`,
+			FullHtml:    `<a href="wiki:b">b</a> <a href="wiki:about">about</a> <a href="wiki:nope">nope</a>`,
+		},
+		{
+			Slug:      "b",
+			Published: time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC),
+			Filename:  "b.md",
+			FullHtml:  `<a href="wiki:old-a">a</a> <a href="wiki:a">a</a>`,
+		},
+		{
+			// Articles win against pages with the same name
+			Slug:      "about",
+			Published: published,
+			Hidden:    true,
+			Filename:  "about.md",
+		},
+	}
+
+	problems := resolveArticleWikiLinks(articles, []string{"about", "contact"})
+
+	if len(problems) != 1 || problems[0].File != "a.md" {
+		t.Errorf("got problems %v, want one for a.md", problems)
+	}
+
+	tests := []struct {
+		full, summary string
+	}{
+		{`<a href="/blog/q/b">b</a> <a href="/blog/q/about">about</a> <a href="wiki:nope">nope</a>`, `<a href="/blog/q/b">b</a>`},
+		{`<a href="/blog/2020/1/2/a">a</a> <a href="/blog/2020/1/2/a">a</a>`, ``},
+	}
+
+	for i, test := range tests {
+		if a := articles[i]; a.FullHtml != test.full || a.SummaryHtml != test.summary {
+			t.Errorf("%s: got %q (summary %q), want %q (summary %q)", a.Slug, a.FullHtml, a.SummaryHtml, test.full, test.summary)
+		}
+	}
+}